@@ -0,0 +1,140 @@
+package tidstrom
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// H.264 NAL unit types that matter for finding where decoding can start.
+// Types nalSlice to nalIDR carry picture slices.
+const (
+	nalSlice = 1 // coded slice of a non-IDR picture
+	nalIDR   = 5 // coded slice of an IDR picture
+	nalSPS   = 7 // sequence parameter set
+)
+
+// ErrNoKeyframe is returned when a video snapshot contains no keyframe to start from.
+var ErrNoKeyframe = errors.New("snapshot has no keyframe")
+
+// annexBStartCode precedes each NAL unit in an Annex B byte stream.
+var annexBStartCode = []byte{0, 0, 0, 1}
+
+// WriteAnnexB writes the snapshot's frames, each an H.264 access unit or NAL
+// unit, to w as an Annex B elementary stream playable with tools such as
+// ffmpeg. Output starts at the first keyframe: a frame marked Keyframe or one
+// containing an IDR slice, or the frame with the sequence parameter set
+// preceding one. Earlier frames cannot be decoded and are skipped. Frames already in Annex B form are copied as they
+// are, and bare NAL units are given a start code.
+//
+// An elementary stream carries no timing, so if timestamps is not nil, the
+// presentation time of each written frame is written to it in milliseconds
+// from the first, in the "timestamp format v2" text format used by mkvmerge.
+func (s *Snapshot) WriteAnnexB(w io.Writer, timestamps io.Writer) error {
+	start := h264Start(s.Frames)
+	if start < 0 {
+		return ErrNoKeyframe
+	}
+
+	if timestamps != nil {
+		if _, err := io.WriteString(timestamps, "# timestamp format v2\n"); err != nil {
+			return err
+		}
+	}
+
+	first := s.Frames[start].Timestamp
+	for _, f := range s.Frames[start:] {
+		if !hasStartCode(f.Data) {
+			if _, err := w.Write(annexBStartCode); err != nil {
+				return err
+			}
+		}
+		if _, err := w.Write(f.Data); err != nil {
+			return err
+		}
+
+		if timestamps != nil {
+			ms := float64(f.Timestamp.Sub(first).Microseconds()) / 1000
+			if _, err := fmt.Fprintf(timestamps, "%.3f\n", ms); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// h264Start returns the index of the first frame decoding can start at, or
+// -1 if there is none. Parameter sets are often sent as frames of their own,
+// so a frame with a sequence parameter set and no slices is a start only if
+// the next frame carrying a slice is an IDR picture.
+func h264Start(frames []Frame) int {
+	for i, f := range frames {
+		idr, slice, sps := h264Contents(&f)
+		if idr {
+			return i
+		}
+		if !sps || slice {
+			continue
+		}
+		for j := i + 1; j < len(frames); j++ {
+			idr, slice, _ := h264Contents(&frames[j])
+			if idr {
+				return i
+			}
+			if slice {
+				break
+			}
+		}
+	}
+	return -1
+}
+
+// h264Contents reports whether f holds an IDR picture, any picture slice and
+// a sequence parameter set. A frame marked Keyframe counts as an IDR picture.
+func h264Contents(f *Frame) (idr, slice, sps bool) {
+	idr = f.Keyframe
+	for _, nal := range nalUnits(f.Data) {
+		switch t := nal[0] & 0x1F; {
+		case t == nalIDR:
+			idr = true
+		case t >= nalSlice && t < nalIDR:
+			slice = true
+		case t == nalSPS:
+			sps = true
+		}
+	}
+	return idr, slice || idr, sps
+}
+
+// hasStartCode reports whether data begins with an Annex B start code.
+func hasStartCode(data []byte) bool {
+	return bytes.HasPrefix(data, []byte{0, 0, 1}) || bytes.HasPrefix(data, annexBStartCode)
+}
+
+// nalUnits splits data into its NAL units: on start codes if it is in Annex B
+// form, or else as a single bare NAL unit.
+func nalUnits(data []byte) [][]byte {
+	if !hasStartCode(data) {
+		if len(data) == 0 {
+			return nil
+		}
+		return [][]byte{data}
+	}
+
+	var units [][]byte
+	for len(data) > 0 {
+		i := bytes.Index(data, []byte{0, 0, 1})
+		if i < 0 {
+			i = len(data)
+		}
+		if unit := bytes.TrimRight(data[:i], "\x00"); len(unit) > 0 {
+			units = append(units, unit)
+		}
+		if i == len(data) {
+			break
+		}
+		data = data[i+3:]
+	}
+	return units
+}
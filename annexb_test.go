@@ -0,0 +1,96 @@
+package tidstrom
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotWriteAnnexB(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	var (
+		pFrame     = []byte{0x41, 0x9A, 0x01}                                                    // bare non-IDR slice
+		idrAU      = []byte{0, 0, 0, 1, 0x67, 0x42, 0, 0, 0, 1, 0x68, 0xCE, 0, 0, 1, 0x65, 0x88} // SPS, PPS, IDR
+		laterFrame = []byte{0x41, 0x9A, 0x02}
+		spsPPS     = []byte{0, 0, 0, 1, 0x67, 0x42, 0, 0, 0, 1, 0x68, 0xCE} // parameter sets only
+		idrSlice   = []byte{0x65, 0x88}
+	)
+
+	testCases := []struct {
+		name       string
+		frames     []Frame
+		expected   []byte
+		timestamps string
+	}{
+		{
+			name: "Starts at the IDR access unit",
+			frames: []Frame{
+				{Data: pFrame, Timestamp: base},
+				{Data: idrAU, Timestamp: base.Add(40 * time.Millisecond)},
+				{Data: laterFrame, Timestamp: base.Add(73500 * time.Microsecond)},
+			},
+			expected:   append(append([]byte{}, idrAU...), append([]byte{0, 0, 0, 1}, laterFrame...)...),
+			timestamps: "# timestamp format v2\n0.000\n33.500\n",
+		},
+		{
+			name: "Keyframe flag",
+			frames: []Frame{
+				{Data: pFrame, Timestamp: base, Keyframe: true},
+				{Data: laterFrame, Timestamp: base.Add(time.Second)},
+			},
+			expected:   append(append([]byte{0, 0, 0, 1}, pFrame...), append([]byte{0, 0, 0, 1}, laterFrame...)...),
+			timestamps: "# timestamp format v2\n0.000\n1000.000\n",
+		},
+		{
+			name: "Parameter sets sent before the IDR frame",
+			frames: []Frame{
+				{Data: spsPPS, Timestamp: base},
+				{Data: pFrame, Timestamp: base.Add(40 * time.Millisecond)},
+				{Data: spsPPS, Timestamp: base.Add(80 * time.Millisecond)},
+				{Data: idrSlice, Timestamp: base.Add(80 * time.Millisecond)},
+			},
+			expected:   append(append([]byte{}, spsPPS...), append([]byte{0, 0, 0, 1}, idrSlice...)...),
+			timestamps: "# timestamp format v2\n0.000\n0.000\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			snapshot := &Snapshot{Frames: tc.frames}
+
+			var stream, timestamps bytes.Buffer
+			require.NoError(t, snapshot.WriteAnnexB(&stream, &timestamps))
+			assert.Equal(t, tc.expected, stream.Bytes())
+			assert.Equal(t, tc.timestamps, timestamps.String())
+
+			stream.Reset()
+			require.NoError(t, snapshot.WriteAnnexB(&stream, nil))
+			assert.Equal(t, tc.expected, stream.Bytes())
+		})
+	}
+
+	var stream strings.Builder
+	err := (&Snapshot{Frames: []Frame{{Data: pFrame}}}).WriteAnnexB(&stream, nil)
+	assert.ErrorIs(t, err, ErrNoKeyframe)
+	assert.Empty(t, stream.String())
+
+	// a sequence parameter set alone does not make a frame decodable
+	spsWithPFrame := []byte{0, 0, 0, 1, 0x67, 0x42, 0, 0, 0, 1, 0x41, 0x9A, 0x03}
+	err = (&Snapshot{Frames: []Frame{{Data: spsWithPFrame}, {Data: pFrame}}}).WriteAnnexB(&stream, nil)
+	assert.ErrorIs(t, err, ErrNoKeyframe)
+	err = (&Snapshot{Frames: []Frame{{Data: spsPPS}, {Data: pFrame}}}).WriteAnnexB(&stream, nil)
+	assert.ErrorIs(t, err, ErrNoKeyframe)
+}
+
+func TestNALUnits(t *testing.T) {
+	units := nalUnits([]byte{0, 0, 0, 1, 0x67, 0x42, 0, 0, 1, 0x68, 0xCE, 0, 0, 0, 1, 0x65})
+	assert.Equal(t, [][]byte{{0x67, 0x42}, {0x68, 0xCE}, {0x65}}, units)
+
+	assert.Equal(t, [][]byte{{0x41, 0x9A}}, nalUnits([]byte{0x41, 0x9A}))
+	assert.Empty(t, nalUnits(nil))
+}
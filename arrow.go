@@ -0,0 +1,361 @@
+package tidstrom
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// Apache Arrow IPC stream constants, from the Arrow flatbuffer schemas
+// (Message.fbs and Schema.fbs).
+const (
+	arrowContinuation = 0xFFFFFFFF
+	arrowMetadataV5   = 4
+	arrowLittleEndian = 0
+
+	// message header types
+	arrowHeaderSchema      = 1
+	arrowHeaderRecordBatch = 3
+
+	// field types
+	arrowTypeInt           = 2
+	arrowTypeFloatingPoint = 3
+	arrowTypeUtf8          = 5
+	arrowTypeBool          = 6
+	arrowTypeTimestamp     = 10
+
+	arrowPrecisionDouble = 2
+	arrowUnitNanosecond  = 3
+)
+
+// WriteArrow writes the snapshot's frames to w in the Apache Arrow IPC
+// stream format, readable with pyarrow.ipc.open_stream, pandas and DuckDB.
+// Each frame's data is decoded into the given columns, which follow a
+// non-nullable timestamp column (nanoseconds, UTC) and a uint64 sequence
+// column. The frames are written as a single record batch.
+func (s *Snapshot) WriteArrow(w io.Writer, columns []Column, decode RowDecoder) error {
+	if err := validateColumns(columns); err != nil {
+		return err
+	}
+
+	n := len(s.Frames)
+	timestamps := make([]byte, 0, 8*n)
+	sequences := make([]byte, 0, 8*n)
+	data := make([]*arrowColumn, len(columns))
+	for i, c := range columns {
+		data[i] = newArrowColumn(c.Type)
+	}
+	for i := range s.Frames {
+		f := &s.Frames[i]
+		row, err := decodeRow(f, columns, decode)
+		if err != nil {
+			return err
+		}
+		timestamps = binary.LittleEndian.AppendUint64(timestamps, uint64(f.Timestamp.UnixNano()))
+		sequences = binary.LittleEndian.AppendUint64(sequences, f.Sequence)
+		for j, v := range row {
+			data[j].append(i, v)
+		}
+	}
+
+	fields := []fbTable{
+		arrowField(timestampColumn, false, arrowTypeTimestamp, fbTable{
+			fbInt16(0, arrowUnitNanosecond),
+			fbRef(1, "UTC"),
+		}),
+		arrowField(sequenceColumn, false, arrowTypeInt, fbTable{fbInt32(0, 64), fbBool(1, false)}),
+	}
+	for _, c := range columns {
+		typeType, typ := arrowType(c.Type)
+		fields = append(fields, arrowField(c.Name, true, typeType, typ))
+	}
+	schema := fbTable{fbInt16(0, arrowLittleEndian), fbRef(1, fields)}
+	if _, err := w.Write(arrowMessage(arrowHeaderSchema, schema, 0)); err != nil {
+		return err
+	}
+
+	// the body holds each column's buffers in schema order, 8-byte aligned
+	var body, nodes, buffers []byte
+	addBuffer := func(b []byte) {
+		buffers = binary.LittleEndian.AppendUint64(buffers, uint64(len(body)))
+		buffers = binary.LittleEndian.AppendUint64(buffers, uint64(len(b)))
+		body = append(body, b...)
+		body = append(body, make([]byte, (8-len(body)%8)%8)...)
+	}
+	addNode := func(nulls int) {
+		nodes = binary.LittleEndian.AppendUint64(nodes, uint64(n))
+		nodes = binary.LittleEndian.AppendUint64(nodes, uint64(nulls))
+	}
+	for _, values := range [][]byte{timestamps, sequences} {
+		addNode(0)
+		addBuffer(nil) // no validity bitmap, as there are no nulls
+		addBuffer(values)
+	}
+	for _, c := range data {
+		addNode(c.nulls)
+		if c.nulls == 0 {
+			addBuffer(nil)
+		} else {
+			addBuffer(c.validity)
+		}
+		if c.typ == ColumnString {
+			addBuffer(c.offsets)
+		}
+		addBuffer(c.values)
+	}
+
+	batch := fbTable{
+		fbInt64(0, int64(n)),
+		fbRef(1, fbStructs(nodes)),
+		fbRef(2, fbStructs(buffers)),
+	}
+	if _, err := w.Write(arrowMessage(arrowHeaderRecordBatch, batch, int64(len(body)))); err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+
+	// end of stream
+	_, err := w.Write(binary.LittleEndian.AppendUint32([]byte{0xFF, 0xFF, 0xFF, 0xFF}, 0))
+	return err
+}
+
+// arrowColumn accumulates the buffers of a decoded column.
+type arrowColumn struct {
+	typ      ColumnType
+	validity []byte // bit set for each non-null value
+	nulls    int
+	offsets  []byte // string columns: int32 start of each value, then the end
+	values   []byte // values, or bits for bool columns
+}
+
+func newArrowColumn(typ ColumnType) *arrowColumn {
+	c := arrowColumn{typ: typ}
+	if typ == ColumnString {
+		c.offsets = make([]byte, 4)
+	}
+	return &c
+}
+
+// append adds the value of row i, one of the column's Go types or nil.
+func (c *arrowColumn) append(i int, v any) {
+	if i%8 == 0 {
+		c.validity = append(c.validity, 0)
+		if c.typ == ColumnBool {
+			c.values = append(c.values, 0)
+		}
+	}
+	if v == nil {
+		c.nulls++
+	} else {
+		c.validity[i/8] |= 1 << (i % 8)
+	}
+
+	switch c.typ {
+	case ColumnInt64:
+		n, _ := v.(int64)
+		c.values = binary.LittleEndian.AppendUint64(c.values, uint64(n))
+	case ColumnFloat64:
+		n, _ := v.(float64)
+		c.values = binary.LittleEndian.AppendUint64(c.values, math.Float64bits(n))
+	case ColumnString:
+		s, _ := v.(string)
+		c.values = append(c.values, s...)
+		c.offsets = binary.LittleEndian.AppendUint32(c.offsets, uint32(len(c.values)))
+	case ColumnBool:
+		if b, _ := v.(bool); b {
+			c.values[i/8] |= 1 << (i % 8)
+		}
+	}
+}
+
+// arrowType returns the Arrow type union tag and table of a column type.
+func arrowType(t ColumnType) (uint8, fbTable) {
+	switch t {
+	case ColumnFloat64:
+		return arrowTypeFloatingPoint, fbTable{fbInt16(0, arrowPrecisionDouble)}
+	case ColumnString:
+		return arrowTypeUtf8, fbTable{}
+	case ColumnBool:
+		return arrowTypeBool, fbTable{}
+	}
+	return arrowTypeInt, fbTable{fbInt32(0, 64), fbBool(1, true)}
+}
+
+// arrowField returns a schema Field table.
+func arrowField(name string, nullable bool, typeType uint8, typ fbTable) fbTable {
+	return fbTable{
+		fbRef(0, name),
+		fbBool(1, nullable),
+		fbUint8(2, typeType),
+		fbRef(3, typ),
+		fbRef(5, []fbTable{}), // children, required by some readers even when empty
+	}
+}
+
+// arrowMessage returns an encapsulated IPC message: the continuation marker,
+// the metadata length and the Message flatbuffer, padded to 8 bytes. A body
+// of bodyLength bytes must follow it.
+func arrowMessage(headerType uint8, header fbTable, bodyLength int64) []byte {
+	meta := fbFinish(fbTable{
+		fbInt16(0, arrowMetadataV5),
+		fbUint8(1, headerType),
+		fbRef(2, header),
+		fbInt64(3, bodyLength),
+	})
+	meta = append(meta, make([]byte, (8-len(meta)%8)%8)...)
+
+	msg := make([]byte, 0, 8+len(meta))
+	msg = binary.LittleEndian.AppendUint32(msg, arrowContinuation)
+	msg = binary.LittleEndian.AppendUint32(msg, uint32(len(meta)))
+	return append(msg, meta...)
+}
+
+// The flatbuffers encoder below supports just what Arrow metadata needs.
+// Objects are written front to back, each followed by the objects it refers
+// to, so that every offset points forward as the format requires.
+
+// fbTable is a flatbuffer table: its fields, in any slot order.
+type fbTable []fbField
+
+// fbField is a table field holding either an inline scalar or a reference to
+// a string, an fbTable, a vector of tables or a vector of structs.
+type fbField struct {
+	slot  int
+	value []byte // little-endian scalar
+	ref   any
+}
+
+// fbStructs is a vector of 16-byte structs of two int64 values, such as
+// Arrow's FieldNode and Buffer.
+type fbStructs []byte
+
+func fbBool(slot int, v bool) fbField {
+	var b byte
+	if v {
+		b = 1
+	}
+	return fbField{slot: slot, value: []byte{b}}
+}
+
+func fbUint8(slot int, v uint8) fbField {
+	return fbField{slot: slot, value: []byte{v}}
+}
+
+func fbInt16(slot int, v int16) fbField {
+	return fbField{slot: slot, value: binary.LittleEndian.AppendUint16(nil, uint16(v))}
+}
+
+func fbInt32(slot int, v int32) fbField {
+	return fbField{slot: slot, value: binary.LittleEndian.AppendUint32(nil, uint32(v))}
+}
+
+func fbInt64(slot int, v int64) fbField {
+	return fbField{slot: slot, value: binary.LittleEndian.AppendUint64(nil, uint64(v))}
+}
+
+func fbRef(slot int, obj any) fbField {
+	return fbField{slot: slot, ref: obj}
+}
+
+// fbFinish returns the flatbuffer with root as its root table. The buffer
+// must be placed at an 8-byte aligned position.
+func fbFinish(root fbTable) []byte {
+	b := fbBuilder{buf: make([]byte, 4)}
+	b.patch(0, b.put(root))
+	return b.buf
+}
+
+// fbBuilder writes flatbuffer objects.
+type fbBuilder struct {
+	buf []byte
+}
+
+// put writes obj at the end of the buffer, followed by everything it refers
+// to, and returns its position.
+func (b *fbBuilder) put(obj any) int {
+	switch o := obj.(type) {
+	case fbTable:
+		return b.putTable(o)
+	case string:
+		b.align(4)
+		pos := len(b.buf)
+		b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(o)))
+		b.buf = append(b.buf, o...)
+		b.buf = append(b.buf, 0)
+		return pos
+	case []fbTable:
+		b.align(4)
+		pos := len(b.buf)
+		b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(o)))
+		b.buf = append(b.buf, make([]byte, 4*len(o))...)
+		for i, t := range o {
+			b.patch(pos+4+4*i, b.put(t))
+		}
+		return pos
+	case fbStructs:
+		for (len(b.buf)+4)%8 != 0 { // align the elements, not the length
+			b.buf = append(b.buf, 0)
+		}
+		pos := len(b.buf)
+		b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(o)/16))
+		b.buf = append(b.buf, o...)
+		return pos
+	}
+	panic("unsupported flatbuffer object")
+}
+
+// putTable writes a table's vtable, then the table, then the objects its fields refer to.
+func (b *fbBuilder) putTable(t fbTable) int {
+	slots, align := 0, 4
+	for _, f := range t {
+		slots = max(slots, f.slot+1)
+		align = max(align, len(f.value))
+	}
+
+	b.align(2)
+	vtable := len(b.buf)
+	b.buf = append(b.buf, make([]byte, 4+2*slots)...)
+
+	b.align(align)
+	table := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(table-vtable))
+
+	type pending struct {
+		at  int
+		obj any
+	}
+	var refs []pending
+	for _, f := range t {
+		if f.ref != nil {
+			b.align(4)
+			refs = append(refs, pending{len(b.buf), f.ref})
+			binary.LittleEndian.PutUint16(b.buf[vtable+4+2*f.slot:], uint16(len(b.buf)-table))
+			b.buf = append(b.buf, 0, 0, 0, 0)
+			continue
+		}
+		b.align(len(f.value))
+		binary.LittleEndian.PutUint16(b.buf[vtable+4+2*f.slot:], uint16(len(b.buf)-table))
+		b.buf = append(b.buf, f.value...)
+	}
+	binary.LittleEndian.PutUint16(b.buf[vtable:], uint16(4+2*slots))
+	binary.LittleEndian.PutUint16(b.buf[vtable+2:], uint16(len(b.buf)-table))
+
+	for _, r := range refs {
+		b.patch(r.at, b.put(r.obj))
+	}
+	return table
+}
+
+// align pads the buffer to a multiple of n bytes.
+func (b *fbBuilder) align(n int) {
+	for len(b.buf)%n != 0 {
+		b.buf = append(b.buf, 0)
+	}
+}
+
+// patch stores at position at the offset from there to target.
+func (b *fbBuilder) patch(at, target int) {
+	binary.LittleEndian.PutUint32(b.buf[at:], uint32(target-at))
+}
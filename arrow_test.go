@@ -0,0 +1,278 @@
+package tidstrom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// arrowMessageData is an IPC message read back from a stream.
+type arrowMessageData struct {
+	meta fbReader
+	body []byte
+}
+
+// readArrowStream splits an IPC stream into its messages, checking the
+// framing and the end-of-stream marker.
+func readArrowStream(t *testing.T, stream []byte) []arrowMessageData {
+	t.Helper()
+	var messages []arrowMessageData
+	for {
+		require.GreaterOrEqual(t, len(stream), 8)
+		require.Equal(t, uint32(arrowContinuation), binary.LittleEndian.Uint32(stream))
+		size := int(binary.LittleEndian.Uint32(stream[4:]))
+		if size == 0 {
+			assert.Len(t, stream, 8, "data after end of stream")
+			return messages
+		}
+		require.Zero(t, size%8, "metadata is padded to 8 bytes")
+
+		meta := fbReader(stream[8 : 8+size])
+		msg := meta.root()
+		assert.Equal(t, uint16(arrowMetadataV5), meta.uint16(msg, 0))
+		bodyLength := int(meta.int64(msg, 3))
+		require.Zero(t, bodyLength%8, "body is padded to 8 bytes")
+
+		stream = stream[8+size:]
+		messages = append(messages, arrowMessageData{meta: meta, body: stream[:bodyLength]})
+		stream = stream[bodyLength:]
+	}
+}
+
+// fbReader reads flatbuffer tables, checking field alignment.
+type fbReader []byte
+
+func (r fbReader) root() int {
+	return int(binary.LittleEndian.Uint32(r))
+}
+
+// field returns the position of a table field, or -1 if it is absent.
+func (r fbReader) field(table, slot int) int {
+	vtable := table - int(int32(binary.LittleEndian.Uint32(r[table:])))
+	if 4+2*slot >= int(binary.LittleEndian.Uint16(r[vtable:])) {
+		return -1
+	}
+	offset := int(binary.LittleEndian.Uint16(r[vtable+4+2*slot:]))
+	if offset == 0 {
+		return -1
+	}
+	return table + offset
+}
+
+func (r fbReader) uint8(table, slot int) uint8 {
+	if p := r.field(table, slot); p >= 0 {
+		return r[p]
+	}
+	return 0
+}
+
+func (r fbReader) uint16(table, slot int) uint16 {
+	if p := r.field(table, slot); p >= 0 {
+		if p%2 != 0 {
+			panic("misaligned field")
+		}
+		return binary.LittleEndian.Uint16(r[p:])
+	}
+	return 0
+}
+
+func (r fbReader) int32(table, slot int) int32 {
+	if p := r.field(table, slot); p >= 0 {
+		if p%4 != 0 {
+			panic("misaligned field")
+		}
+		return int32(binary.LittleEndian.Uint32(r[p:]))
+	}
+	return 0
+}
+
+func (r fbReader) int64(table, slot int) int64 {
+	if p := r.field(table, slot); p >= 0 {
+		if p%8 != 0 {
+			panic("misaligned field")
+		}
+		return int64(binary.LittleEndian.Uint64(r[p:]))
+	}
+	return 0
+}
+
+// ref returns the position of the object a field refers to, or -1.
+func (r fbReader) ref(table, slot int) int {
+	p := r.field(table, slot)
+	if p < 0 {
+		return -1
+	}
+	if p%4 != 0 {
+		panic("misaligned offset")
+	}
+	return p + int(binary.LittleEndian.Uint32(r[p:]))
+}
+
+func (r fbReader) string(table, slot int) string {
+	p := r.ref(table, slot)
+	if p < 0 {
+		return ""
+	}
+	n := int(binary.LittleEndian.Uint32(r[p:]))
+	return string(r[p+4 : p+4+n])
+}
+
+// vector returns the position of the first element of a vector and its length.
+func (r fbReader) vector(table, slot int) (int, int) {
+	p := r.ref(table, slot)
+	if p < 0 {
+		return -1, 0
+	}
+	return p + 4, int(binary.LittleEndian.Uint32(r[p:]))
+}
+
+// tables returns the positions of the tables in a vector.
+func (r fbReader) tables(table, slot int) []int {
+	start, n := r.vector(table, slot)
+	tables := make([]int, n)
+	for i := range tables {
+		p := start + 4*i
+		tables[i] = p + int(binary.LittleEndian.Uint32(r[p:]))
+	}
+	return tables
+}
+
+// int64s returns a vector of structs as their int64 members.
+func (r fbReader) int64s(table, slot int) []int64 {
+	start, n := r.vector(table, slot)
+	if start%8 != 0 {
+		panic("misaligned structs")
+	}
+	values := make([]int64, 2*n)
+	for i := range values {
+		values[i] = int64(binary.LittleEndian.Uint64(r[start+8*i:]))
+	}
+	return values
+}
+
+func TestSnapshotWriteArrow(t *testing.T) {
+	snapshot := testSnapshot(time.Second, sensorRecords...)
+
+	var buf bytes.Buffer
+	require.NoError(t, snapshot.WriteArrow(&buf, sensorColumns, decodeSensor))
+	messages := readArrowStream(t, buf.Bytes())
+	require.Len(t, messages, 2)
+
+	t.Run("schema", func(t *testing.T) {
+		meta := messages[0].meta
+		msg := meta.root()
+		require.Equal(t, uint8(arrowHeaderSchema), meta.uint8(msg, 1))
+		assert.Empty(t, messages[0].body)
+
+		type field struct {
+			name     string
+			nullable bool
+			typeType uint8
+		}
+		var fields []field
+		schema := meta.ref(msg, 2)
+		for _, f := range meta.tables(schema, 1) {
+			fields = append(fields, field{meta.string(f, 0), meta.uint8(f, 1) == 1, meta.uint8(f, 2)})
+			_, children := meta.vector(f, 5)
+			assert.Zero(t, children)
+		}
+		assert.Equal(t, []field{
+			{"timestamp", false, arrowTypeTimestamp},
+			{"sequence", false, arrowTypeInt},
+			{"sensor", true, arrowTypeUtf8},
+			{"temperature", true, arrowTypeFloatingPoint},
+			{"alarm", true, arrowTypeBool},
+			{"reading", true, arrowTypeInt},
+		}, fields)
+
+		tables := meta.tables(schema, 1)
+		timestampType := meta.ref(tables[0], 3)
+		assert.Equal(t, uint16(arrowUnitNanosecond), meta.uint16(timestampType, 0))
+		assert.Equal(t, "UTC", meta.string(timestampType, 1))
+
+		sequenceType := meta.ref(tables[1], 3)
+		assert.Equal(t, int32(64), meta.int32(sequenceType, 0))
+		assert.Equal(t, uint8(0), meta.uint8(sequenceType, 1), "unsigned")
+
+		readingType := meta.ref(tables[5], 3)
+		assert.Equal(t, int32(64), meta.int32(readingType, 0))
+		assert.Equal(t, uint8(1), meta.uint8(readingType, 1), "signed")
+	})
+
+	t.Run("record batch", func(t *testing.T) {
+		meta, body := messages[1].meta, messages[1].body
+		msg := meta.root()
+		require.Equal(t, uint8(arrowHeaderRecordBatch), meta.uint8(msg, 1))
+		batch := meta.ref(msg, 2)
+		assert.Equal(t, int64(3), meta.int64(batch, 0))
+
+		// length and null count of each column
+		assert.Equal(t, []int64{3, 0, 3, 0, 3, 0, 3, 1, 3, 0, 3, 0}, meta.int64s(batch, 1))
+
+		raw := meta.int64s(batch, 2)
+		require.Len(t, raw, 2*13)
+		buffers := make([][]byte, 0, 13)
+		for i := 0; i < len(raw); i += 2 {
+			assert.Zero(t, raw[i]%8, "buffer offsets are 8-byte aligned")
+			buffers = append(buffers, body[raw[i]:raw[i]+raw[i+1]])
+		}
+
+		int64s := func(b []byte) []int64 {
+			var values []int64
+			for i := 0; i < len(b); i += 8 {
+				values = append(values, int64(binary.LittleEndian.Uint64(b[i:])))
+			}
+			return values
+		}
+
+		var timestamps []int64
+		for _, f := range snapshot.Frames {
+			timestamps = append(timestamps, f.Timestamp.UnixNano())
+		}
+		assert.Empty(t, buffers[0])
+		assert.Equal(t, timestamps, int64s(buffers[1]))
+		assert.Empty(t, buffers[2])
+		assert.Equal(t, []int64{10, 11, 12}, int64s(buffers[3]))
+
+		// sensor: validity, offsets, data
+		assert.Empty(t, buffers[4])
+		assert.Equal(t, []byte{0, 0, 0, 0, 2, 0, 0, 0, 4, 0, 0, 0, 8, 0, 0, 0}, buffers[5])
+		assert.Equal(t, `t1t2t"3"`, string(buffers[6]))
+
+		// temperature: the second value is null
+		assert.Equal(t, []byte{0b101}, buffers[7])
+		temperatures := int64s(buffers[8])
+		require.Len(t, temperatures, 3)
+		assert.Equal(t, 21.5, math.Float64frombits(uint64(temperatures[0])))
+		assert.Equal(t, -0.25, math.Float64frombits(uint64(temperatures[2])))
+
+		// alarm: bits
+		assert.Empty(t, buffers[9])
+		assert.Equal(t, []byte{0b010}, buffers[10])
+
+		assert.Empty(t, buffers[11])
+		assert.Equal(t, []int64{7, 8, 9}, int64s(buffers[12]))
+	})
+
+	t.Run("empty snapshot", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, (&Snapshot{}).WriteArrow(&buf, sensorColumns, decodeSensor))
+		messages := readArrowStream(t, buf.Bytes())
+		require.Len(t, messages, 2)
+		batch := messages[1].meta.ref(messages[1].meta.root(), 2)
+		assert.Zero(t, messages[1].meta.int64(batch, 0))
+	})
+
+	t.Run("decoder errors", func(t *testing.T) {
+		snapshot := testSnapshot(time.Second, sensorRecords...)
+		snapshot.Frames[2].Data = []byte("garbage")
+		var buf bytes.Buffer
+		assert.ErrorContains(t, snapshot.WriteArrow(&buf, sensorColumns, decodeSensor), "frame 12")
+		assert.Zero(t, buf.Len(), "nothing is written before all frames are decoded")
+	})
+}
@@ -0,0 +1,177 @@
+package tidstrom
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"time"
+)
+
+// Clip contains the frames captured around one or more triggers.
+// Overlapping triggers share a single clip spanning all of them.
+type Clip struct {
+	Snapshot
+	Triggers []time.Time `json:"triggers"` // stream time at which each merged trigger fired
+}
+
+// triggerRequest bundles the parameters and result channel for a trigger.
+type triggerRequest struct {
+	pre, post  time.Duration
+	resultChan chan *Clip // buffered so the loop never blocks on delivery
+}
+
+// clipState is the clip being collected. It is owned by processLoop.
+type clipState struct {
+	frames   []Frame
+	start    time.Time // earliest pre-roll frame time
+	end      time.Time // latest post-roll frame time
+	triggers []time.Time
+	waiters  []chan *Clip
+}
+
+// Trigger captures a clip of the frames from pre before now until post after now,
+// where now is the stream time: the newest frame timestamp, advanced by the
+// time elapsed since that frame arrived.
+// The pre-roll is taken from the buffer immediately; Trigger then waits while
+// the post-roll is collected from incoming frames. A trigger fired while
+// another clip is still collecting extends that clip instead, and every
+// caller receives the combined clip. Clip frames are private copies that are
+// shared between merged triggers and must not be modified.
+func (sb *StreamBuffer) Trigger(ctx context.Context, pre, post time.Duration) (*Clip, error) {
+	if pre < 0 || post < 0 {
+		return nil, errors.New("pre-roll and post-roll must not be negative")
+	}
+	if !sb.running.Load() || sb.finalStopped.Load() {
+		return nil, errors.New("stream buffer is not running")
+	}
+
+	sb.shutdownMu.Lock()
+	shutdownCh := sb.shutdown
+	sb.shutdownMu.Unlock()
+
+	if shutdownCh == nil {
+		return nil, errors.New("stream buffer is shutting down")
+	}
+
+	req := triggerRequest{
+		pre:        pre,
+		post:       post,
+		resultChan: make(chan *Clip, 1),
+	}
+
+	select {
+	case sb.trigReq <- req:
+	case <-shutdownCh:
+		return nil, ErrStopped
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	select {
+	case clip := <-req.resultChan:
+		return clip, nil
+	case <-shutdownCh:
+		return nil, ErrStopped
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// startClip begins a new clip or extends the one being collected. The clip
+// is bounded in stream time, so it lines up with the frame timestamps even
+// when the capture clock lags the buffer's.
+func (sb *StreamBuffer) startClip(req triggerRequest) {
+	now := sb.now()
+	start, end := now.Add(-req.pre), now.Add(req.post)
+
+	if sb.clip != nil && now.After(sb.clip.end) {
+		sb.finishClip() // due but not yet delivered
+	}
+
+	if sb.clip == nil {
+		sb.clip = &clipState{
+			frames: sb.clipHistory(start, time.Time{}),
+			start:  start,
+			end:    end,
+		}
+	} else {
+		if start.Before(sb.clip.start) {
+			// extend the pre-roll with frames before the current clip
+			earlier := sb.clipHistory(start, sb.clip.start)
+			sb.clip.frames = append(earlier, sb.clip.frames...)
+			sb.clip.start = start
+		}
+		if end.After(sb.clip.end) {
+			sb.clip.end = end
+		}
+	}
+
+	sb.clip.triggers = append(sb.clip.triggers, now)
+	sb.clip.waiters = append(sb.clip.waiters, req.resultChan)
+	sb.triggersPending.Add(1)
+}
+
+// clipHistory copies buffered frames with timestamps from from up to, but
+// excluding, before. A zero before leaves the range open.
+func (sb *StreamBuffer) clipHistory(from, before time.Time) []Frame {
+	sb.mu.RLock()
+	defer sb.mu.RUnlock()
+
+	var frames []Frame
+	for _, pos := range (snapshotQuery{from: from}).selectFrames(sb) {
+		f := sb.frames[sb.index(pos)]
+		if !before.IsZero() && !f.Timestamp.Before(before) {
+			break
+		}
+		f.Data = bytes.Clone(f.Data)
+		f.Metadata = f.Metadata.clone()
+		f.ref = nil
+		frames = append(frames, f)
+	}
+	return frames
+}
+
+// collectClipFrame adds a detached frame to the clip being collected, if it falls within it.
+func (sb *StreamBuffer) collectClipFrame(f Frame) {
+	if sb.clip == nil || f.Timestamp.Before(sb.clip.start) || f.Timestamp.After(sb.clip.end) {
+		return
+	}
+	sb.clip.frames = append(sb.clip.frames, f)
+}
+
+// finishClip delivers the collected clip to every waiting trigger.
+func (sb *StreamBuffer) finishClip() {
+	state := sb.clip
+	sb.clip = nil
+
+	// frames arrive out of order when reordered or collected after the pre-roll
+	slices.SortStableFunc(state.frames, func(a, b Frame) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+
+	clip := Clip{
+		Snapshot: Snapshot{
+			ID:        sb.makeID(),
+			Frames:    state.frames,
+			Timestamp: sb.clock.Now(),
+		},
+		Triggers: state.triggers,
+	}
+	if clip.Frames == nil {
+		clip.Frames = []Frame{}
+	}
+	if len(clip.Frames) > 0 {
+		clip.StartTime = clip.Frames[0].Timestamp
+		clip.EndTime = clip.Frames[len(clip.Frames)-1].Timestamp
+	}
+
+	for _, waiter := range state.waiters {
+		// each caller gets its own frame slice so Release does not affect the others
+		c := clip
+		c.Frames = slices.Clone(clip.Frames)
+		waiter <- &c
+	}
+	sb.triggersPending.Add(-int64(len(state.waiters)))
+	sb.clipsSent.Add(1)
+}
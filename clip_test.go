@@ -0,0 +1,162 @@
+package tidstrom
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alesr/tidstrom/tidstromtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clipResult is the outcome of a Trigger call made in the background.
+type clipResult struct {
+	clip *Clip
+	err  error
+}
+
+// triggerAsync calls Trigger in the background and waits until the trigger is handled.
+func triggerAsync(t *testing.T, sb *StreamBuffer, pre, post time.Duration) <-chan clipResult {
+	t.Helper()
+
+	pending := sb.GetMetrics().TriggersPending
+	result := make(chan clipResult, 1)
+	go func() {
+		clip, err := sb.Trigger(context.Background(), pre, post)
+		result <- clipResult{clip: clip, err: err}
+	}()
+
+	require.Eventually(t, func() bool {
+		return sb.GetMetrics().TriggersPending > pending
+	}, time.Second, time.Millisecond)
+	return result
+}
+
+// pushAt pushes a frame captured at ts and waits for it to be processed.
+func pushAt(t *testing.T, sb *StreamBuffer, data string, ts time.Time) {
+	t.Helper()
+
+	processed := sb.GetMetrics().FramesProcessed
+	require.NoError(t, sb.PushFrame(context.Background(), Frame{Data: []byte(data), Timestamp: ts}))
+	require.Eventually(t, func() bool {
+		return sb.GetMetrics().FramesProcessed > processed
+	}, time.Second, time.Millisecond)
+}
+
+func TestStreamBufferTrigger(t *testing.T) {
+	sb, clock, base := newTestBuffer(t)
+
+	result := triggerAsync(t, sb, 3*time.Second, 2*time.Second)
+
+	pushAt(t, sb, "Post 0", base.Add(10500*time.Millisecond))
+	pushAt(t, sb, "Post 1", base.Add(11500*time.Millisecond))
+	pushAt(t, sb, "Too late", base.Add(12500*time.Millisecond))
+
+	select {
+	case <-result:
+		require.FailNow(t, "clip should not be delivered before the post-roll ends")
+	default:
+	}
+
+	clock.Advance(2 * time.Second)
+
+	res := <-result
+	require.NoError(t, res.err)
+	assert.Equal(t, 0, sb.GetMetrics().TriggersPending)
+
+	clip := res.clip
+	assert.Equal(t, []string{"Frame 7", "Frame 8", "Frame 9", "Post 0", "Post 1"}, frameData(clip.Frames))
+	assert.Equal(t, []time.Time{base.Add(10 * time.Second)}, clip.Triggers)
+	assert.Equal(t, base.Add(7*time.Second), clip.StartTime)
+	assert.Equal(t, base.Add(11500*time.Millisecond), clip.EndTime)
+	assert.Equal(t, uint64(1), sb.GetMetrics().ClipsSent)
+}
+
+func TestStreamBufferTriggerMerge(t *testing.T) {
+	sb, clock, base := newTestBuffer(t)
+
+	first := triggerAsync(t, sb, 3*time.Second, 2*time.Second)
+	clock.Advance(500 * time.Millisecond)
+	pushAt(t, sb, "Post 0", base.Add(10500*time.Millisecond))
+
+	clock.Advance(500 * time.Millisecond)
+
+	// overlaps the first clip, extending it both ways
+	second := triggerAsync(t, sb, 5*time.Second, 3*time.Second)
+	pushAt(t, sb, "Post 1", base.Add(11500*time.Millisecond))
+	pushAt(t, sb, "Post 2", base.Add(13*time.Second))
+
+	clock.Advance(3 * time.Second)
+
+	res1, res2 := <-first, <-second
+	require.NoError(t, res1.err)
+	require.NoError(t, res2.err)
+
+	expected := []string{"Frame 6", "Frame 7", "Frame 8", "Frame 9", "Post 0", "Post 1", "Post 2"}
+	assert.Equal(t, expected, frameData(res1.clip.Frames))
+	assert.Equal(t, expected, frameData(res2.clip.Frames))
+	assert.Equal(t, res1.clip.ID, res2.clip.ID, "merged triggers should share a clip")
+	assert.Equal(t, []time.Time{base.Add(10 * time.Second), base.Add(11 * time.Second)}, res1.clip.Triggers)
+	assert.Equal(t, uint64(1), sb.GetMetrics().ClipsSent)
+
+	// releasing one caller's clip leaves the other intact
+	res1.clip.Release()
+	assert.Equal(t, expected, frameData(res2.clip.Frames))
+}
+
+func TestStreamBufferTriggerLaggingCaptureClock(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := tidstromtest.NewClock(base.Add(time.Hour))
+
+	sb := NewStreamBuffer(WithWindow(2*time.Hour), WithClock(clock))
+	sb.Start()
+	defer sb.Stop()
+
+	// capture timestamps run an hour behind the buffer's clock
+	for i := range 10 {
+		pushAt(t, sb, fmt.Sprintf("Frame %d", i), base.Add(time.Duration(i)*time.Second))
+	}
+	clock.Advance(time.Second)
+
+	result := triggerAsync(t, sb, 3*time.Second, 2*time.Second)
+	pushAt(t, sb, "Post 0", base.Add(10500*time.Millisecond))
+
+	clock.Advance(time.Second)
+	pushAt(t, sb, "Post 1", base.Add(11500*time.Millisecond))
+
+	select {
+	case <-result:
+		require.FailNow(t, "clip should not be delivered before the post-roll ends")
+	default:
+	}
+
+	clock.Advance(time.Second)
+
+	res := <-result
+	require.NoError(t, res.err)
+	assert.Equal(t, []string{"Frame 7", "Frame 8", "Frame 9", "Post 0", "Post 1"}, frameData(res.clip.Frames))
+	assert.Equal(t, []time.Time{base.Add(10 * time.Second)}, res.clip.Triggers)
+}
+
+func TestStreamBufferTriggerErrors(t *testing.T) {
+	sb := NewStreamBuffer()
+
+	_, err := sb.Trigger(context.Background(), time.Second, time.Second)
+	assert.Error(t, err, "should fail when not running")
+
+	sb.Start()
+
+	_, err = sb.Trigger(context.Background(), -time.Second, time.Second)
+	assert.Error(t, err, "should reject negative pre-roll")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = sb.Trigger(ctx, time.Second, time.Hour)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	sb.Stop()
+	_, err = sb.Trigger(context.Background(), time.Second, time.Second)
+	assert.Error(t, err, "should fail after stop")
+}
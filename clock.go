@@ -0,0 +1,23 @@
+package tidstrom
+
+import "time"
+
+// Clock provides the current time and timers to a StreamBuffer.
+// Replace the system clock with WithClock to control time in tests and simulations.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// systemClock reads the wall clock.
+type systemClock struct{}
+
+// Now returns the current local time.
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// After waits for the duration to elapse and then sends the current time on the returned channel.
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
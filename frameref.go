@@ -0,0 +1,36 @@
+package tidstrom
+
+import "sync/atomic"
+
+// frameRef counts the holders of a frame's data buffer and returns the
+// buffer to its pool once the last holder releases it.
+type frameRef struct {
+	refs atomic.Int32
+	data []byte
+	pool *bufferPool
+}
+
+// newFrameRef wraps data with a single reference held by the caller.
+func newFrameRef(data []byte, pool *bufferPool) *frameRef {
+	r := frameRef{data: data, pool: pool}
+	r.refs.Store(1)
+	return &r
+}
+
+// retain adds a holder.
+func (r *frameRef) retain() {
+	r.refs.Add(1)
+}
+
+// release drops a holder, recycling the buffer when none remain.
+func (r *frameRef) release() {
+	if r.refs.Add(-1) == 0 {
+		r.pool.put(r.data)
+		r.data = nil
+	}
+}
+
+// view returns the shared data, capped so appends cannot write into the buffer.
+func (r *frameRef) view() []byte {
+	return r.data[:len(r.data):len(r.data)]
+}
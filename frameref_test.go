@@ -0,0 +1,42 @@
+package tidstrom
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrameRef(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Recycles after last release", func(t *testing.T) {
+		t.Parallel()
+
+		bp := newBufferPool(64)
+		ref := newFrameRef(append(bp.get(), 1, 2, 3), bp)
+		ref.retain()
+		assert.Equal(t, int32(2), ref.refs.Load())
+
+		ref.release()
+		assert.Equal(t, []byte{1, 2, 3}, ref.data, "data should survive while a holder remains")
+
+		ref.release()
+		assert.Equal(t, int32(0), ref.refs.Load())
+		assert.Nil(t, ref.data, "data should be recycled after the last release")
+	})
+
+	t.Run("View is capped", func(t *testing.T) {
+		t.Parallel()
+
+		bp := newBufferPool(64)
+		ref := newFrameRef(append(bp.get(), 1, 2, 3), bp)
+
+		view := ref.view()
+		require.Equal(t, 3, cap(view), "view capacity should match its length")
+
+		view = append(view, 4)
+		assert.Equal(t, []byte{1, 2, 3}, ref.data, "appending to a view should not touch the buffer")
+		assert.Equal(t, []byte{1, 2, 3, 4}, view)
+	})
+}
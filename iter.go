@@ -0,0 +1,110 @@
+package tidstrom
+
+import (
+	"context"
+	"iter"
+	"sort"
+	"time"
+)
+
+// iterChunkSize is the number of frames All reads per lock acquisition.
+const iterChunkSize = 64
+
+// iterCursor is the position of the last frame read by All.
+type iterCursor struct {
+	timestamp time.Time
+	sequence  uint64
+	started   bool
+}
+
+// All returns an iterator over the frames in the window, oldest first,
+// yielding each frame with its position in the iteration. Frames are read
+// in bounded chunks, holding the buffer's read lock only while a chunk is
+// read, and their data is not copied: each frame is a read-only view that
+// is valid until the loop body returns, even if the frame is evicted in the
+// meantime. Use bytes.Clone to keep the data.
+//
+// Frames stored after All is called are not yielded, nor are frames evicted
+// before their chunk is read. Iteration stops early when ctx is done, and
+// no further chunks are read once the buffer is stopped.
+func (sb *StreamBuffer) All(ctx context.Context) iter.Seq2[int, Frame] {
+	return func(yield func(int, Frame) bool) {
+		sb.mu.RLock()
+		endSeq := sb.nextSeq
+		cutoff := sb.streamTime().Add(-sb.window)
+		sb.mu.RUnlock()
+
+		var (
+			cursor iterCursor
+			chunk  = make([]Frame, 0, iterChunkSize)
+			n      int
+		)
+		for ctx.Err() == nil {
+			chunk = sb.readChunk(chunk[:0], &cursor, cutoff, endSeq)
+			if len(chunk) == 0 {
+				return
+			}
+
+			for i, f := range chunk {
+				view := f
+				view.ref = nil
+
+				if ctx.Err() != nil || !yield(n, view) {
+					releaseFrames(chunk[i:])
+					return
+				}
+				n++
+				if f.ref != nil {
+					f.ref.release()
+				}
+			}
+		}
+	}
+}
+
+// readChunk appends to dst the frames following the cursor, up to the
+// capacity of dst, and advances the cursor. Frames before cutoff or
+// sequenced at or after endSeq are skipped. The returned frames hold a
+// reference to their data, which the caller must release.
+func (sb *StreamBuffer) readChunk(dst []Frame, cursor *iterCursor, cutoff time.Time, endSeq uint64) []Frame {
+	sb.mu.RLock()
+	defer sb.mu.RUnlock()
+
+	if sb.finalStopped.Load() {
+		return dst // frame data has been recycled
+	}
+
+	// frames with equal timestamps are ordered by sequence,
+	// so the cursor position is found by binary search
+	start := sort.Search(sb.count, func(i int) bool {
+		f := &sb.frames[sb.index(i)]
+		if !cursor.started {
+			return !f.Timestamp.Before(cutoff)
+		}
+		return f.Timestamp.After(cursor.timestamp) ||
+			f.Timestamp.Equal(cursor.timestamp) && f.Sequence > cursor.sequence
+	})
+
+	for i := start; i < sb.count && len(dst) < cap(dst); i++ {
+		f := sb.frames[sb.index(i)]
+		cursor.timestamp, cursor.sequence, cursor.started = f.Timestamp, f.Sequence, true
+
+		if f.Sequence >= endSeq {
+			continue // stored after iteration began
+		}
+		if f.ref != nil {
+			f.ref.retain()
+		}
+		dst = append(dst, f)
+	}
+	return dst
+}
+
+// releaseFrames drops the data references held by frames.
+func releaseFrames(frames []Frame) {
+	for _, f := range frames {
+		if f.ref != nil {
+			f.ref.release()
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package tidstrom
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alesr/tidstrom/tidstromtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamBufferAll(t *testing.T) {
+	sb, _, _ := newTestBuffer(t)
+
+	var (
+		positions []int
+		data      []string
+	)
+	for i, frame := range sb.All(context.Background()) {
+		positions = append(positions, i)
+		data = append(data, string(frame.Data))
+	}
+
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, positions)
+	assert.Equal(t, []string{"Frame 0", "Frame 1", "Frame 2", "Frame 3", "Frame 4",
+		"Frame 5", "Frame 6", "Frame 7", "Frame 8", "Frame 9"}, data)
+
+	// breaking out early stops the iteration
+	var seen int
+	for range sb.All(context.Background()) {
+		seen++
+		if seen == 3 {
+			break
+		}
+	}
+	assert.Equal(t, 3, seen)
+}
+
+func TestStreamBufferAllChunks(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	n := iterChunkSize + 10
+
+	sb := NewStreamBuffer(
+		WithWindow(time.Hour),
+		WithCapacity(n),
+		WithInputBuffer(2*n),
+		WithClock(tidstromtest.NewClock(base.Add(time.Hour))),
+	)
+	sb.Start()
+	defer sb.Stop()
+
+	push := func(first int) {
+		for i := first; i < first+n; i++ {
+			require.NoError(t, sb.PushFrame(context.Background(), Frame{
+				Data:      fmt.Appendf(nil, "Frame %d", i),
+				Timestamp: base.Add(time.Duration(i) * time.Millisecond),
+			}))
+		}
+		require.Eventually(t, func() bool {
+			return sb.GetMetrics().FramesProcessed == uint64(first+n)
+		}, time.Second, time.Millisecond)
+	}
+	push(0)
+
+	var data []string
+	for i, frame := range sb.All(context.Background()) {
+		if i == 0 {
+			// replace every frame while the first chunk is being read
+			push(n)
+		}
+		data = append(data, string(frame.Data))
+	}
+
+	require.Len(t, data, iterChunkSize,
+		"frames evicted before their chunk is read and frames stored later should be skipped")
+	for i, d := range data {
+		assert.Equal(t, fmt.Sprintf("Frame %d", i), d, "data should stay valid after eviction")
+	}
+}
+
+func TestStreamBufferAllContext(t *testing.T) {
+	sb, _, _ := newTestBuffer(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var seen int
+	for range sb.All(ctx) {
+		seen++
+		if seen == 2 {
+			cancel()
+		}
+	}
+	assert.Equal(t, 2, seen)
+
+	for range sb.All(ctx) {
+		require.FailNow(t, "a done context should yield nothing")
+	}
+}
+
+func TestStreamBufferAllStopped(t *testing.T) {
+	sb, _, _ := newTestBuffer(t)
+	sb.Stop()
+
+	for range sb.All(context.Background()) {
+		require.FailNow(t, "a stopped buffer should yield nothing")
+	}
+}
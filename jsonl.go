@@ -0,0 +1,139 @@
+package tidstrom
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// DataEncoding selects how frame data is represented in JSON Lines.
+type DataEncoding int
+
+const (
+	// DataBase64 encodes data as a base64 string, as encoding/json does for []byte.
+	DataBase64 DataEncoding = iota
+	// DataRaw writes data as a plain string, for text payloads such as log
+	// lines or JSON events. Invalid UTF-8 is replaced with U+FFFD.
+	DataRaw
+	// DataOmit leaves data out, keeping only the frame's other fields.
+	DataOmit
+)
+
+// jsonlFrame is the JSON Lines representation of a frame.
+type jsonlFrame struct {
+	ID        string          `json:"id"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	Timestamp time.Time       `json:"timestamp"`
+	Sequence  uint64          `json:"sequence"`
+	Metadata  Metadata        `json:"metadata,omitempty"`
+	Keyframe  bool            `json:"keyframe,omitempty"`
+}
+
+// WriteJSONL writes the snapshot's frames to w as JSON Lines, one frame
+// object per line, with data represented according to enc.
+func (s *Snapshot) WriteJSONL(w io.Writer, enc DataEncoding) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+
+	for _, f := range s.Frames {
+		line := jsonlFrame{
+			ID:        f.ID,
+			Timestamp: f.Timestamp,
+			Sequence:  f.Sequence,
+			Metadata:  f.Metadata,
+			Keyframe:  f.Keyframe,
+		}
+
+		var err error
+		switch enc {
+		case DataBase64:
+			line.Data, err = json.Marshal(f.Data)
+		case DataRaw:
+			line.Data, err = json.Marshal(string(f.Data))
+		case DataOmit:
+		default:
+			return fmt.Errorf("unknown data encoding %d", enc)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := encoder.Encode(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// JSONLReader reads frames written by Snapshot.WriteJSONL one line at a time.
+type JSONLReader struct {
+	decoder *json.Decoder
+	enc     DataEncoding
+	line    int // lines read so far
+}
+
+// NewJSONLReader returns a reader for the frames in r. enc must match the
+// encoding the frames were written with; frames written with DataOmit are
+// read without data.
+func NewJSONLReader(r io.Reader, enc DataEncoding) *JSONLReader {
+	return &JSONLReader{decoder: json.NewDecoder(r), enc: enc}
+}
+
+// Next returns the next frame, or io.EOF at the end of input.
+func (jr *JSONLReader) Next() (Frame, error) {
+	var jf jsonlFrame
+	if err := jr.decoder.Decode(&jf); err != nil {
+		if errors.Is(err, io.EOF) {
+			return Frame{}, io.EOF
+		}
+		return Frame{}, fmt.Errorf("frame %d: %w", jr.line+1, err)
+	}
+	jr.line++
+
+	f := Frame{
+		ID:        jf.ID,
+		Timestamp: jf.Timestamp,
+		Sequence:  jf.Sequence,
+		Metadata:  jf.Metadata,
+		Keyframe:  jf.Keyframe,
+	}
+	if len(jf.Data) > 0 {
+		switch jr.enc {
+		case DataBase64:
+			if err := json.Unmarshal(jf.Data, &f.Data); err != nil {
+				return Frame{}, fmt.Errorf("frame %d: %w", jr.line, err)
+			}
+		case DataRaw:
+			var data string
+			if err := json.Unmarshal(jf.Data, &data); err != nil {
+				return Frame{}, fmt.Errorf("frame %d: %w", jr.line, err)
+			}
+			f.Data = []byte(data)
+		case DataOmit:
+		default:
+			return Frame{}, fmt.Errorf("unknown data encoding %d", jr.enc)
+		}
+	}
+	return f, nil
+}
+
+// ReadJSONL reads all frames written by Snapshot.WriteJSONL from r until the
+// end of input, returning the frames read before any error. Use JSONLReader
+// to read large inputs a frame at a time.
+func ReadJSONL(r io.Reader, enc DataEncoding) ([]Frame, error) {
+	jr := NewJSONLReader(r, enc)
+
+	frames := []Frame{}
+	for {
+		f, err := jr.Next()
+		if errors.Is(err, io.EOF) {
+			return frames, nil
+		}
+		if err != nil {
+			return frames, err
+		}
+		frames = append(frames, f)
+	}
+}
@@ -0,0 +1,122 @@
+package tidstrom
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotJSONL(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	snapshot := &Snapshot{
+		ID: "snapshot",
+		Frames: []Frame{
+			{
+				ID:        "01",
+				Data:      []byte(`{"level":"error","msg":"<disk full>"}`),
+				Timestamp: base,
+				Sequence:  1,
+				Metadata:  Metadata{"host": "db-1"},
+			},
+			{ID: "02", Data: []byte("plain line"), Timestamp: base.Add(time.Second), Sequence: 2, Keyframe: true},
+		},
+	}
+
+	testCases := []struct {
+		name      string
+		enc       DataEncoding
+		firstData any
+		expected  []string
+	}{
+		{
+			name:      "Base64",
+			enc:       DataBase64,
+			firstData: "eyJsZXZlbCI6ImVycm9yIiwibXNnIjoiPGRpc2sgZnVsbD4ifQ==",
+			expected:  []string{`{"level":"error","msg":"<disk full>"}`, "plain line"},
+		},
+		{
+			name:      "Raw",
+			enc:       DataRaw,
+			firstData: `{"level":"error","msg":"<disk full>"}`,
+			expected:  []string{`{"level":"error","msg":"<disk full>"}`, "plain line"},
+		},
+		{
+			name:     "Omit",
+			enc:      DataOmit,
+			expected: []string{"", ""},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, snapshot.WriteJSONL(&buf, tc.enc))
+
+			lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+			require.Len(t, lines, 2, "one line per frame")
+
+			var first map[string]any
+			require.NoError(t, json.Unmarshal([]byte(lines[0]), &first))
+			assert.Equal(t, tc.firstData, first["data"])
+			assert.Equal(t, "01", first["id"])
+			assert.Equal(t, map[string]any{"host": "db-1"}, first["metadata"])
+			assert.NotContains(t, first, "keyframe")
+
+			frames, err := ReadJSONL(&buf, tc.enc)
+			require.NoError(t, err)
+			require.Len(t, frames, 2)
+			for i, frame := range frames {
+				want := snapshot.Frames[i]
+				assert.Equal(t, tc.expected[i], string(frame.Data))
+				assert.Equal(t, want.ID, frame.ID)
+				assert.Equal(t, want.Sequence, frame.Sequence)
+				assert.True(t, want.Timestamp.Equal(frame.Timestamp))
+				assert.Equal(t, want.Metadata, frame.Metadata)
+				assert.Equal(t, want.Keyframe, frame.Keyframe)
+			}
+		})
+	}
+}
+
+func TestReadJSONLErrors(t *testing.T) {
+	frames, err := ReadJSONL(strings.NewReader(""), DataBase64)
+	require.NoError(t, err)
+	assert.Empty(t, frames)
+
+	input := `{"id":"01","data":"aGk=","timestamp":"2024-01-01T12:00:00Z","sequence":1}
+{"id":"02","data":"not base64!","timestamp":"2024-01-01T12:00:01Z","sequence":2}
+`
+	frames, err = ReadJSONL(strings.NewReader(input), DataBase64)
+	require.ErrorContains(t, err, "frame 2")
+	require.Len(t, frames, 1, "frames before the error should be returned")
+	assert.Equal(t, "hi", string(frames[0].Data))
+
+	_, err = ReadJSONL(strings.NewReader("{broken\n"), DataRaw)
+	assert.ErrorContains(t, err, "frame 1")
+}
+
+func TestJSONLReader(t *testing.T) {
+	input := `{"id":"01","data":"first","timestamp":"2024-01-01T12:00:00Z","sequence":1}
+{"id":"02","data":"second","timestamp":"2024-01-01T12:00:01Z","sequence":2}
+{broken
+`
+	jr := NewJSONLReader(strings.NewReader(input), DataRaw)
+
+	for _, want := range []string{"first", "second"} {
+		frame, err := jr.Next()
+		require.NoError(t, err)
+		assert.Equal(t, want, string(frame.Data))
+	}
+	_, err := jr.Next()
+	assert.ErrorContains(t, err, "frame 3")
+
+	jr = NewJSONLReader(strings.NewReader(""), DataRaw)
+	_, err = jr.Next()
+	assert.ErrorIs(t, err, io.EOF)
+}
@@ -0,0 +1,219 @@
+package tidstrom
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alesr/tidstrom/tidstromtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pushGOPs pushes frames one second apart starting at base, marking those
+// whose index is in keyframes, and waits until they are processed.
+func pushGOPs(t *testing.T, sb *StreamBuffer, base time.Time, first, n int, keyframes ...int) {
+	t.Helper()
+
+	isKey := make(map[int]bool)
+	for _, k := range keyframes {
+		isKey[k] = true
+	}
+
+	processed := sb.GetMetrics().FramesProcessed
+	for i := first; i < first+n; i++ {
+		require.NoError(t, sb.PushFrame(context.Background(), Frame{
+			Data:      fmt.Appendf(nil, "Frame %d", i),
+			Timestamp: base.Add(time.Duration(i) * time.Second),
+			Keyframe:  isKey[i],
+		}))
+	}
+	require.Eventually(t, func() bool {
+		return sb.GetMetrics().FramesProcessed == processed+uint64(n)
+	}, time.Second, time.Millisecond)
+}
+
+func TestStreamBufferKeyframeTrimming(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name     string
+		opts     []StreamBufferOption
+		expected []string
+	}{
+		{
+			name:     "Unaligned",
+			expected: []string{"Frame 5", "Frame 6", "Frame 7", "Frame 8", "Frame 9", "Frame 15"},
+		},
+		{
+			name:     "Aligned keeps the group the window starts in",
+			opts:     []StreamBufferOption{WithKeyframeAlignment()},
+			expected: []string{"Frame 4", "Frame 5", "Frame 6", "Frame 7", "Frame 8", "Frame 9", "Frame 15"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := tidstromtest.NewClock(base.Add(15 * time.Second))
+			sb := NewStreamBuffer(append([]StreamBufferOption{
+				WithWindow(10 * time.Second),
+				WithClock(clock),
+			}, tc.opts...)...)
+			sb.Start()
+			defer sb.Stop()
+
+			pushGOPs(t, sb, base, 0, 10, 0, 4, 8)
+			pushGOPs(t, sb, base, 15, 1)
+
+			snapshot, err := sb.GetSnapshot(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, frameData(snapshot.Frames))
+		})
+	}
+}
+
+func TestStreamBufferKeyframeEviction(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	t.Run("Capacity", func(t *testing.T) {
+		sb := NewStreamBuffer(
+			WithWindow(time.Hour),
+			WithCapacity(6),
+			WithKeyframeAlignment(),
+			WithClock(tidstromtest.NewClock(base.Add(10*time.Second))),
+		)
+		sb.Start()
+		defer sb.Stop()
+
+		pushGOPs(t, sb, base, 0, 7, 0, 3)
+
+		snapshot, err := sb.GetSnapshot(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Frame 3", "Frame 4", "Frame 5", "Frame 6"}, frameData(snapshot.Frames),
+			"the whole oldest group should be evicted to make room")
+	})
+
+	t.Run("Byte budget", func(t *testing.T) {
+		sb := NewStreamBuffer(
+			WithWindow(time.Hour),
+			WithMaxBytes(40), // five 7-byte frames
+			WithKeyframeAlignment(),
+			WithClock(tidstromtest.NewClock(base.Add(10*time.Second))),
+		)
+		sb.Start()
+		defer sb.Stop()
+
+		pushGOPs(t, sb, base, 0, 6, 0, 3)
+
+		snapshot, err := sb.GetSnapshot(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Frame 3", "Frame 4", "Frame 5"}, frameData(snapshot.Frames))
+		assert.Equal(t, uint64(3), sb.GetMetrics().FramesEvicted)
+	})
+
+	t.Run("No later keyframe", func(t *testing.T) {
+		sb := NewStreamBuffer(
+			WithWindow(time.Hour),
+			WithCapacity(3),
+			WithKeyframeAlignment(),
+			WithClock(tidstromtest.NewClock(base.Add(10*time.Second))),
+		)
+		sb.Start()
+		defer sb.Stop()
+
+		pushGOPs(t, sb, base, 0, 4, 0)
+
+		snapshot, err := sb.GetSnapshot(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Frame 1", "Frame 2", "Frame 3"}, frameData(snapshot.Frames),
+			"a single frame should be evicted when no keyframe follows")
+	})
+}
+
+func TestStreamBufferFromKeyframe(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	sb := NewStreamBuffer(
+		WithWindow(time.Hour),
+		WithClock(tidstromtest.NewClock(base.Add(10*time.Second))),
+	)
+	sb.Start()
+	defer sb.Stop()
+
+	pushGOPs(t, sb, base, 0, 10, 2, 6)
+
+	testCases := []struct {
+		name     string
+		from, to time.Time
+		expected []string
+	}{
+		{
+			name:     "Extends back to the preceding keyframe",
+			from:     base.Add(4 * time.Second),
+			to:       base.Add(5 * time.Second),
+			expected: []string{"Frame 2", "Frame 3", "Frame 4", "Frame 5"},
+		},
+		{
+			name:     "Starts on a keyframe",
+			from:     base.Add(6 * time.Second),
+			to:       base.Add(7 * time.Second),
+			expected: []string{"Frame 6", "Frame 7"},
+		},
+		{
+			name:     "Advances to the first keyframe in range",
+			from:     base,
+			to:       base.Add(3 * time.Second),
+			expected: []string{"Frame 2", "Frame 3"},
+		},
+		{
+			name:     "No keyframe",
+			from:     base,
+			to:       base.Add(time.Second),
+			expected: []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			snapshot, err := sb.GetRange(ctx, tc.from, tc.to, FromKeyframe())
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, frameData(snapshot.Frames))
+		})
+	}
+
+	snapshot, err := sb.GetSnapshot(ctx, FromKeyframe())
+	require.NoError(t, err)
+	require.Len(t, snapshot.Frames, 8)
+	assert.True(t, snapshot.Frames[0].Keyframe)
+	assert.True(t, snapshot.Frames[4].Keyframe)
+	assert.False(t, snapshot.Frames[1].Keyframe)
+}
+
+func TestStreamBufferKeyframeTrimSchedule(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := tidstromtest.NewClock(base.Add(9 * time.Second))
+	sb := NewStreamBuffer(
+		WithWindow(10*time.Second),
+		WithClock(clock),
+		WithKeyframeAlignment(),
+	)
+	sb.Start()
+	defer sb.Stop()
+
+	pushGOPs(t, sb, base, 0, 10, 0, 4, 8)
+
+	// the first group is trimmed when frame 3 expires, at 13s
+	delay, ok := sb.nextTrimDelay()
+	require.True(t, ok)
+	assert.Equal(t, 4*time.Second, delay)
+
+	// after frame 0 has expired, the group is still kept whole
+	clock.Set(base.Add(11 * time.Second))
+	delay, ok = sb.nextTrimDelay()
+	require.True(t, ok)
+	assert.Equal(t, 2*time.Second, delay, "trim should wait for the group to expire rather than poll")
+	assert.Equal(t, 10, sb.GetMetrics().FrameCount)
+}
@@ -0,0 +1,26 @@
+package tidstrom
+
+import "maps"
+
+// Metadata holds attributes describing a frame, such as its codec and
+// dimensions or a reading's unit and source.
+type Metadata map[string]string
+
+// Matches reports whether m contains every key with the same value as want.
+// An empty want matches any metadata.
+func (m Metadata) Matches(want Metadata) bool {
+	for k, v := range want {
+		if got, ok := m[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// clone returns a copy of m, or nil if m is empty.
+func (m Metadata) clone() Metadata {
+	if len(m) == 0 {
+		return nil
+	}
+	return maps.Clone(m)
+}
@@ -0,0 +1,104 @@
+package tidstrom
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alesr/tidstrom/tidstromtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetadataMatches(t *testing.T) {
+	md := Metadata{"codec": "h264", "width": "1920"}
+
+	testCases := []struct {
+		name     string
+		want     Metadata
+		expected bool
+	}{
+		{name: "Nil filter", want: nil, expected: true},
+		{name: "Subset", want: Metadata{"codec": "h264"}, expected: true},
+		{name: "All pairs", want: Metadata{"codec": "h264", "width": "1920"}, expected: true},
+		{name: "Different value", want: Metadata{"codec": "h265"}, expected: false},
+		{name: "Missing key", want: Metadata{"height": "1080"}, expected: false},
+		{name: "Empty value is not a missing key", want: Metadata{"unit": ""}, expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, md.Matches(tc.want))
+		})
+	}
+
+	assert.False(t, Metadata(nil).Matches(Metadata{"codec": "h264"}))
+}
+
+func TestStreamBufferMetadata(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	sb := NewStreamBuffer(
+		WithWindow(time.Hour),
+		WithClock(tidstromtest.NewClock(base.Add(10*time.Second))),
+	)
+	sb.Start()
+	defer sb.Stop()
+
+	ctx := context.Background()
+	live, err := sb.Subscribe(ctx, SubscribeOptions{Metadata: Metadata{"source": "cam-2"}})
+	require.NoError(t, err)
+
+	sources := []string{"cam-1", "cam-2", "cam-1", "cam-2"}
+	pushed := make([]Metadata, 0, len(sources))
+	for i, source := range sources {
+		md := Metadata{"source": source, "codec": "h264"}
+		require.NoError(t, sb.PushFrame(ctx, Frame{
+			Data:      []byte(source),
+			Timestamp: base.Add(time.Duration(i) * time.Second),
+			Metadata:  md,
+		}))
+		pushed = append(pushed, md)
+	}
+	require.Eventually(t, func() bool {
+		return sb.GetMetrics().FramesProcessed == uint64(len(sources))
+	}, time.Second, time.Millisecond)
+
+	// the buffer keeps its own copies
+	for _, md := range pushed {
+		md["codec"] = "changed"
+	}
+
+	snapshot, err := sb.GetSnapshot(ctx)
+	require.NoError(t, err)
+	require.Len(t, snapshot.Frames, 4)
+	for i, frame := range snapshot.Frames {
+		assert.Equal(t, Metadata{"source": sources[i], "codec": "h264"}, frame.Metadata)
+	}
+
+	// snapshot metadata is a copy
+	snapshot.Frames[0].Metadata["source"] = "changed"
+
+	matching, err := sb.GetMatching(ctx, Metadata{"source": "cam-1"})
+	require.NoError(t, err)
+	require.Len(t, matching.Frames, 2)
+	assert.Equal(t, uint64(0), matching.Frames[0].Sequence)
+	assert.Equal(t, uint64(2), matching.Frames[1].Sequence)
+
+	for _, seq := range []uint64{1, 3} {
+		frame, ok := receive(t, live)
+		require.True(t, ok)
+		assert.Equal(t, seq, frame.Sequence, "only cam-2 frames should be delivered")
+		assert.Equal(t, "cam-2", frame.Metadata["source"])
+	}
+
+	replay, err := sb.Subscribe(ctx, SubscribeOptions{
+		Start:    StartAtSequence(0),
+		Metadata: Metadata{"source": "cam-1"},
+	})
+	require.NoError(t, err)
+	for _, seq := range []uint64{0, 2} {
+		frame, ok := receive(t, replay)
+		require.True(t, ok)
+		assert.Equal(t, seq, frame.Sequence, "replay should apply the metadata filter")
+	}
+}
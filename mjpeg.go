@@ -0,0 +1,233 @@
+package tidstrom
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime/multipart"
+	"net/textproto"
+	"strconv"
+	"time"
+)
+
+// defaultFrameInterval is the frame interval assumed for a single-frame video.
+const defaultFrameInterval = time.Second
+
+// ErrNotJPEG is returned when a frame's data is not a JPEG image with a frame header.
+var ErrNotJPEG = errors.New("frame is not a JPEG image")
+
+// WriteMJPEG writes the snapshot's frames, each a JPEG image, to w as a
+// multipart MJPEG stream separated by boundary, as served with the content
+// type "multipart/x-mixed-replace; boundary=" + boundary. Each part carries
+// the frame's capture time in an X-Timestamp header (RFC 3339) for pacing.
+func (s *Snapshot) WriteMJPEG(w io.Writer, boundary string) error {
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(boundary); err != nil {
+		return err
+	}
+
+	for _, f := range s.Frames {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", "image/jpeg")
+		header.Set("Content-Length", strconv.Itoa(len(f.Data)))
+		header.Set("X-Timestamp", f.Timestamp.Format(time.RFC3339Nano))
+
+		part, err := mw.CreatePart(header)
+		if err != nil {
+			return err
+		}
+		if _, err := part.Write(f.Data); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+// WriteAVI writes the snapshot's frames, each a JPEG image, to w as an AVI
+// file with a Motion JPEG video stream. The dimensions are taken from the
+// first frame, and the constant frame rate of the file from the average
+// interval between frame timestamps.
+func (s *Snapshot) WriteAVI(w io.Writer) error {
+	if len(s.Frames) == 0 {
+		return errors.New("snapshot has no frames")
+	}
+
+	width, height, err := jpegSize(s.Frames[0].Data)
+	if err != nil {
+		return err
+	}
+
+	interval := defaultFrameInterval
+	if n := len(s.Frames); n > 1 {
+		span := s.Frames[n-1].Timestamp.Sub(s.Frames[0].Timestamp)
+		if avg := span / time.Duration(n-1); avg > 0 {
+			interval = avg
+		}
+	}
+	usPerFrame := uint32(max(interval.Microseconds(), 1))
+
+	var (
+		moviSize int64
+		maxFrame int
+	)
+	for _, f := range s.Frames {
+		moviSize += int64(8 + padded(len(f.Data)))
+		maxFrame = max(maxFrame, len(f.Data))
+	}
+	frames := uint32(len(s.Frames))
+
+	const (
+		avihSize = 56
+		strhSize = 56
+		strfSize = 40
+		strlSize = 4 + 8 + strhSize + 8 + strfSize
+		hdrlSize = 4 + 8 + avihSize + 8 + strlSize
+
+		aviHasIndex  = 0x10
+		aviKeyframe  = 0x10
+		idxEntrySize = 16
+	)
+	idx1Size := len(s.Frames) * idxEntrySize
+	riffSize := 4 + 8 + hdrlSize + 8 + 4 + moviSize + 8 + int64(idx1Size)
+	if riffSize > math.MaxUint32 {
+		return errors.New("video too large for an AVI file")
+	}
+
+	b := make([]byte, 0, 12+8+hdrlSize+12)
+	b = appendChunkHeader(b, "RIFF", int(riffSize))
+	b = append(b, "AVI "...)
+
+	b = appendChunkHeader(b, "LIST", hdrlSize)
+	b = append(b, "hdrl"...)
+	b = appendChunkHeader(b, "avih", avihSize)
+	b = appendUint32s(b,
+		usPerFrame,
+		uint32(int64(maxFrame)*1e6/int64(usPerFrame)), // max bytes per second
+		0,           // padding granularity
+		aviHasIndex, // flags
+		frames,
+		0, // initial frames
+		1, // streams
+		uint32(maxFrame),
+		uint32(width),
+		uint32(height),
+		0, 0, 0, 0, // reserved
+	)
+
+	b = appendChunkHeader(b, "LIST", strlSize)
+	b = append(b, "strl"...)
+	b = appendChunkHeader(b, "strh", strhSize)
+	b = append(b, "vidsMJPG"...)
+	b = appendUint32s(b,
+		0, // flags
+		0, // priority and language
+		0, // initial frames
+		usPerFrame,
+		1_000_000, // rate: frames per second is rate/scale
+		0,         // start
+		frames,
+		uint32(maxFrame),
+		0xFFFFFFFF, // default quality
+		0,          // sample size, variable
+	)
+	b = binary.LittleEndian.AppendUint16(b, 0)
+	b = binary.LittleEndian.AppendUint16(b, 0)
+	b = binary.LittleEndian.AppendUint16(b, uint16(width))
+	b = binary.LittleEndian.AppendUint16(b, uint16(height))
+
+	b = appendChunkHeader(b, "strf", strfSize)
+	b = appendUint32s(b, strfSize, uint32(width), uint32(height))
+	b = binary.LittleEndian.AppendUint16(b, 1)  // planes
+	b = binary.LittleEndian.AppendUint16(b, 24) // bits per pixel
+	b = append(b, "MJPG"...)
+	b = appendUint32s(b, uint32(width*height*3), 0, 0, 0, 0)
+
+	b = appendChunkHeader(b, "LIST", int(4+moviSize))
+	b = append(b, "movi"...)
+	if _, err := w.Write(b); err != nil {
+		return err
+	}
+
+	index := make([]byte, 0, 8+idx1Size)
+	index = appendChunkHeader(index, "idx1", idx1Size)
+	offset := 4 // relative to the "movi" list type
+	for _, f := range s.Frames {
+		chunk := appendChunkHeader(make([]byte, 0, 8), "00dc", len(f.Data))
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+		if _, err := w.Write(f.Data); err != nil {
+			return err
+		}
+		if len(f.Data)%2 == 1 {
+			if _, err := w.Write([]byte{0}); err != nil {
+				return err
+			}
+		}
+
+		index = append(index, "00dc"...)
+		index = appendUint32s(index, aviKeyframe, uint32(offset), uint32(len(f.Data)))
+		offset += 8 + padded(len(f.Data))
+	}
+
+	_, err = w.Write(index)
+	return err
+}
+
+// appendChunkHeader appends a RIFF chunk ID and size.
+func appendChunkHeader(b []byte, id string, size int) []byte {
+	b = append(b, id...)
+	return binary.LittleEndian.AppendUint32(b, uint32(size))
+}
+
+// appendUint32s appends little-endian 32-bit values.
+func appendUint32s(b []byte, values ...uint32) []byte {
+	for _, v := range values {
+		b = binary.LittleEndian.AppendUint32(b, v)
+	}
+	return b
+}
+
+// padded returns n rounded up to an even number, as RIFF chunks are word-aligned.
+func padded(n int) int {
+	return n + n%2
+}
+
+// jpegSize returns the dimensions of a JPEG image from its frame header.
+func jpegSize(data []byte) (int, int, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 0, 0, ErrNotJPEG
+	}
+
+	for pos := 2; pos+4 <= len(data); {
+		if data[pos] != 0xFF {
+			return 0, 0, fmt.Errorf("%w: invalid marker", ErrNotJPEG)
+		}
+		marker := data[pos+1]
+		switch {
+		case marker == 0xFF: // fill byte
+			pos++
+			continue
+		case marker == 0x01 || marker >= 0xD0 && marker <= 0xD8: // no payload
+			pos += 2
+			continue
+		case marker == 0xD9 || marker == 0xDA: // end of image or start of scan
+			return 0, 0, fmt.Errorf("%w: no frame header", ErrNotJPEG)
+		}
+
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		isSOF := marker >= 0xC0 && marker <= 0xCF && marker != 0xC4 && marker != 0xC8 && marker != 0xCC
+		if isSOF {
+			if length < 7 || pos+9 > len(data) {
+				break
+			}
+			height := int(binary.BigEndian.Uint16(data[pos+5:]))
+			width := int(binary.BigEndian.Uint16(data[pos+7:]))
+			return width, height, nil
+		}
+		pos += 2 + length
+	}
+	return 0, 0, fmt.Errorf("%w: truncated", ErrNotJPEG)
+}
@@ -0,0 +1,122 @@
+package tidstrom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"mime/multipart"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testJPEG returns a minimal JPEG image header with the given dimensions
+// followed by an arbitrary payload.
+func testJPEG(width, height int, payload string) []byte {
+	b := []byte{0xFF, 0xD8}                           // start of image
+	b = append(b, 0xFF, 0xE0, 0x00, 0x04, 0x00, 0x00) // empty APP0 segment
+	b = append(b, 0xFF, 0xC0, 0x00, 0x0B, 0x08)       // SOF0, 8-bit precision
+	b = binary.BigEndian.AppendUint16(b, uint16(height))
+	b = binary.BigEndian.AppendUint16(b, uint16(width))
+	b = append(b, 0x01, 0x01, 0x11, 0x00) // one component
+	b = append(b, payload...)
+	return append(b, 0xFF, 0xD9) // end of image
+}
+
+func TestJPEGSize(t *testing.T) {
+	width, height, err := jpegSize(testJPEG(1920, 1080, "payload"))
+	require.NoError(t, err)
+	assert.Equal(t, 1920, width)
+	assert.Equal(t, 1080, height)
+
+	_, _, err = jpegSize([]byte("not a jpeg"))
+	assert.ErrorIs(t, err, ErrNotJPEG)
+
+	_, _, err = jpegSize([]byte{0xFF, 0xD8, 0xFF, 0xDA, 0x00, 0x02})
+	assert.ErrorIs(t, err, ErrNotJPEG, "scan data before a frame header")
+}
+
+func TestSnapshotWriteMJPEG(t *testing.T) {
+	snapshot := testSnapshot(40*time.Millisecond,
+		testJPEG(640, 480, "a"), testJPEG(640, 480, "bb"), testJPEG(640, 480, "ccc"))
+
+	var buf bytes.Buffer
+	require.NoError(t, snapshot.WriteMJPEG(&buf, "frame"))
+
+	mr := multipart.NewReader(&buf, "frame")
+	for _, want := range snapshot.Frames {
+		part, err := mr.NextPart()
+		require.NoError(t, err)
+
+		assert.Equal(t, "image/jpeg", part.Header.Get("Content-Type"))
+		ts, err := time.Parse(time.RFC3339Nano, part.Header.Get("X-Timestamp"))
+		require.NoError(t, err)
+		assert.True(t, want.Timestamp.Equal(ts))
+
+		data, err := io.ReadAll(part)
+		require.NoError(t, err)
+		assert.Equal(t, want.Data, data)
+	}
+	_, err := mr.NextPart()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestSnapshotWriteAVI(t *testing.T) {
+	snapshot := testSnapshot(40*time.Millisecond,
+		testJPEG(640, 480, "a"), testJPEG(640, 480, "bb"), testJPEG(640, 480, "ccc"))
+
+	var buf bytes.Buffer
+	require.NoError(t, snapshot.WriteAVI(&buf))
+	avi := buf.Bytes()
+
+	u32 := func(pos int) uint32 { return binary.LittleEndian.Uint32(avi[pos:]) }
+
+	require.Equal(t, "RIFF", string(avi[:4]))
+	assert.Equal(t, uint32(len(avi)-8), u32(4), "RIFF size")
+	assert.Equal(t, "AVI ", string(avi[8:12]))
+
+	// main header
+	avih := bytes.Index(avi, []byte("avih")) + 8
+	assert.Equal(t, uint32(40_000), u32(avih), "microseconds per frame")
+	assert.Equal(t, uint32(3), u32(avih+16), "total frames")
+	assert.Equal(t, uint32(640), u32(avih+32), "width")
+	assert.Equal(t, uint32(480), u32(avih+36), "height")
+
+	strh := bytes.Index(avi, []byte("strh")) + 8
+	assert.Equal(t, "vidsMJPG", string(avi[strh:strh+8]))
+
+	// every index entry points at its frame chunk
+	movi := bytes.Index(avi, []byte("movi"))
+	idx1 := bytes.Index(avi, []byte("idx1"))
+	require.Positive(t, movi)
+	require.Positive(t, idx1)
+	assert.Equal(t, uint32(3*16), u32(idx1+4))
+	assert.Equal(t, len(avi), idx1+8+3*16)
+
+	for i, frame := range snapshot.Frames {
+		entry := idx1 + 8 + i*16
+		assert.Equal(t, "00dc", string(avi[entry:entry+4]))
+		offset := movi + int(u32(entry+8))
+		size := int(u32(entry + 12))
+
+		assert.Equal(t, "00dc", string(avi[offset:offset+4]))
+		assert.Equal(t, size, int(u32(offset+4)))
+		assert.Equal(t, frame.Data, avi[offset+8:offset+8+size])
+	}
+
+	assert.Error(t, (&Snapshot{}).WriteAVI(&buf))
+	assert.ErrorIs(t, (&Snapshot{Frames: []Frame{{Data: []byte("png")}}}).WriteAVI(&buf), ErrNotJPEG)
+
+	// frames sharing one 64MB image add up to more than 4GB
+	large := make([]byte, 64<<20)
+	copy(large, testJPEG(640, 480, ""))
+	frames := make([]Frame, 65)
+	for i := range frames {
+		frames[i] = Frame{Data: large}
+	}
+	buf.Reset()
+	assert.ErrorContains(t, (&Snapshot{Frames: frames}).WriteAVI(&buf), "too large")
+	assert.Zero(t, buf.Len(), "nothing should be written")
+}
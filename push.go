@@ -0,0 +1,227 @@
+package tidstrom
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrStopped is returned when pushing to a StreamBuffer that has been stopped.
+	ErrStopped = errors.New("stream buffer is stopped")
+
+	// ErrInputFull is returned when the input queue is full and the backpressure policy drops the frame.
+	ErrInputFull = errors.New("stream buffer input is full")
+
+	// ErrFrameTooLarge is returned when a frame exceeds the size set with WithMaxFrameSize.
+	ErrFrameTooLarge = errors.New("frame exceeds maximum frame size")
+)
+
+// DropReason describes why a pushed frame was not accepted.
+type DropReason int
+
+const (
+	// DropInputFull means the input queue had no room for the frame.
+	DropInputFull DropReason = iota
+	// DropStopped means the buffer was stopped.
+	DropStopped
+	// DropOversize means the frame exceeded the maximum frame size.
+	DropOversize
+	// DropDisplaced means a queued frame was evicted to make room under BackpressureDropOldest.
+	DropDisplaced
+	// DropSampled means the frame was skipped under BackpressureSample.
+	DropSampled
+)
+
+// BackpressurePolicy controls what happens to incoming frames when the input queue is full.
+// Frames sent on Input or InputFrames are queued as if by Push, so a send only
+// blocks while the policy makes Push wait.
+type BackpressurePolicy int
+
+const (
+	// BackpressureBlock makes Push and sends on the input channels wait for room.
+	// TryPush drops the new frame.
+	BackpressureBlock BackpressurePolicy = iota
+	// BackpressureDropNewest drops the new frame.
+	BackpressureDropNewest
+	// BackpressureDropOldest evicts the oldest queued frame to make room for the new one.
+	BackpressureDropOldest
+	// BackpressureSample keeps every Nth frame while the queue is full, evicting the
+	// oldest queued frame to make room for it, and drops the rest.
+	BackpressureSample
+)
+
+// String returns a readable name for the drop reason.
+func (r DropReason) String() string {
+	switch r {
+	case DropInputFull:
+		return "input full"
+	case DropStopped:
+		return "stopped"
+	case DropOversize:
+		return "oversize"
+	case DropDisplaced:
+		return "displaced"
+	case DropSampled:
+		return "sampled"
+	default:
+		return "unknown"
+	}
+}
+
+// TryPush queues data without blocking, stamping it when it is processed.
+// It reports false if the frame was dropped, which is counted in Metrics.FramesDropped.
+// When the input is full the backpressure policy decides which frame is dropped.
+// The data is copied when processed, so it must not be modified after pushing.
+func (sb *StreamBuffer) TryPush(data []byte) bool {
+	return sb.TryPushFrame(Frame{Data: data})
+}
+
+// TryPushFrame is like TryPush but keeps the frame's capture timestamp, as with InputFrames.
+// Like the data, the frame's Metadata is copied when processed.
+func (sb *StreamBuffer) TryPushFrame(f Frame) bool {
+	return sb.enqueue(context.Background(), f, false) == nil
+}
+
+// Push queues data, applying the backpressure policy when the input is full.
+// Under BackpressureBlock it waits for room until ctx is done.
+// Frames that cannot be queued are counted in Metrics.FramesDropped and the
+// cause is returned: ErrStopped, ErrFrameTooLarge, ErrInputFull or the context error.
+// The data is copied when processed, so it must not be modified after pushing.
+func (sb *StreamBuffer) Push(ctx context.Context, data []byte) error {
+	return sb.PushFrame(ctx, Frame{Data: data})
+}
+
+// PushFrame is like Push but keeps the frame's capture timestamp, as with InputFrames.
+// Like the data, the frame's Metadata is copied when processed.
+func (sb *StreamBuffer) PushFrame(ctx context.Context, f Frame) error {
+	return sb.enqueue(ctx, f, true)
+}
+
+// enqueue queues a frame, applying the backpressure policy when the input is full.
+// Waiting is only allowed under BackpressureBlock and when wait is set.
+func (sb *StreamBuffer) enqueue(ctx context.Context, f Frame, wait bool) error {
+	if err := sb.admit(f); err != nil {
+		return err
+	}
+
+	select {
+	case sb.queue <- f:
+		return nil
+	default:
+	}
+
+	switch sb.backpressure {
+	case BackpressureDropOldest:
+		sb.displace(f)
+		return nil
+
+	case BackpressureSample:
+		if sb.sampleCount.Add(1)%uint64(sb.sampleEvery) != 0 {
+			sb.framesSampledOut.Add(1)
+			sb.drop(DropSampled, f.Data)
+			return ErrInputFull
+		}
+		sb.displace(f)
+		return nil
+
+	case BackpressureBlock:
+		if wait {
+			return sb.waitEnqueue(ctx, f)
+		}
+	}
+
+	sb.framesDroppedNewest.Add(1)
+	sb.drop(DropInputFull, f.Data)
+	return ErrInputFull
+}
+
+// waitEnqueue blocks until the frame is queued, the buffer stops or ctx is done.
+func (sb *StreamBuffer) waitEnqueue(ctx context.Context, f Frame) error {
+	sb.shutdownMu.Lock()
+	shutdownCh := sb.shutdown
+	sb.shutdownMu.Unlock()
+
+	if shutdownCh == nil {
+		sb.drop(DropStopped, f.Data)
+		return ErrStopped
+	}
+
+	sb.pushesBlocked.Add(1)
+
+	select {
+	case sb.queue <- f:
+		return nil
+	case <-shutdownCh:
+		sb.drop(DropStopped, f.Data)
+		return ErrStopped
+	case <-ctx.Done():
+		sb.framesDroppedNewest.Add(1)
+		sb.drop(DropInputFull, f.Data)
+		return ctx.Err()
+	}
+}
+
+// displace queues the frame, evicting the oldest queued frames until it fits.
+func (sb *StreamBuffer) displace(f Frame) {
+	for {
+		select {
+		case sb.queue <- f:
+			return
+		default:
+		}
+
+		select {
+		case old := <-sb.queue:
+			sb.framesDroppedOldest.Add(1)
+			sb.drop(DropDisplaced, old.Data)
+		default:
+		}
+	}
+}
+
+// forwardInput queues the frames sent on Input and InputFrames until the
+// buffer stops, applying the backpressure policy to them.
+func (sb *StreamBuffer) forwardInput(shutdownCh <-chan struct{}) {
+	input, frameInput := sb.input, sb.frameInput
+	for input != nil || frameInput != nil {
+		var f Frame
+		select {
+		case <-shutdownCh:
+			return
+		case data, ok := <-input:
+			if !ok {
+				input = nil // closed by the caller
+				continue
+			}
+			f = Frame{Data: data}
+		case frame, ok := <-frameInput:
+			if !ok {
+				frameInput = nil
+				continue
+			}
+			f = frame
+		}
+		sb.enqueue(context.Background(), f, true)
+	}
+}
+
+// admit checks whether a frame may be queued, dropping it if not.
+func (sb *StreamBuffer) admit(f Frame) error {
+	if sb.finalStopped.Load() {
+		sb.drop(DropStopped, f.Data)
+		return ErrStopped
+	}
+	if sb.maxFrameSize > 0 && len(f.Data) > sb.maxFrameSize {
+		sb.drop(DropOversize, f.Data)
+		return ErrFrameTooLarge
+	}
+	return nil
+}
+
+// drop records a dropped frame and reports it to the drop handler, if any.
+func (sb *StreamBuffer) drop(reason DropReason, data []byte) {
+	sb.framesDropped.Add(1)
+	if sb.dropHandler != nil {
+		sb.dropHandler(reason, data)
+	}
+}
@@ -0,0 +1,265 @@
+package tidstrom
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dropRecorder collects drop reasons reported to a drop handler.
+type dropRecorder struct {
+	mu      sync.Mutex
+	reasons []DropReason
+}
+
+func (r *dropRecorder) record(reason DropReason, _ []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reasons = append(r.reasons, reason)
+}
+
+func (r *dropRecorder) get() []DropReason {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]DropReason(nil), r.reasons...)
+}
+
+func TestStreamBufferTryPush(t *testing.T) {
+	var drops dropRecorder
+	sb := NewStreamBuffer(
+		WithInputBuffer(2),
+		WithMaxFrameSize(16),
+		WithDropHandler(drops.record),
+	)
+
+	// not started, so the queue fills up
+	assert.True(t, sb.TryPush([]byte("Frame 0")), "should queue first frame")
+	assert.True(t, sb.TryPush([]byte("Frame 1")), "should queue second frame")
+	assert.False(t, sb.TryPush([]byte("Frame 2")), "should drop when input is full")
+	assert.False(t, sb.TryPush(make([]byte, 17)), "should drop oversize frame")
+
+	sb.Start()
+	require.Eventually(t, func() bool {
+		return sb.GetMetrics().FramesProcessed == 2
+	}, time.Second, time.Millisecond)
+
+	snapshot, err := sb.GetSnapshot(context.Background())
+	require.NoError(t, err)
+	require.Len(t, snapshot.Frames, 2)
+	for i, frame := range snapshot.Frames {
+		assert.Equal(t, fmt.Sprintf("Frame %d", i), string(frame.Data))
+	}
+
+	sb.Stop()
+	assert.False(t, sb.TryPush([]byte("Frame 3")), "should drop after stop")
+
+	assert.Equal(t, uint64(3), sb.GetMetrics().FramesDropped, "should count every dropped frame")
+	assert.Equal(t, []DropReason{DropInputFull, DropOversize, DropStopped}, drops.get())
+}
+
+func TestStreamBufferPush(t *testing.T) {
+	t.Run("Delivers frames", func(t *testing.T) {
+		sb := NewStreamBuffer()
+		sb.Start()
+		defer sb.Stop()
+
+		capture := time.Now().Add(-time.Second)
+		require.NoError(t, sb.Push(context.Background(), []byte("Frame 0")))
+		require.NoError(t, sb.PushFrame(context.Background(), Frame{Data: []byte("Frame 1"), Timestamp: capture}))
+
+		require.Eventually(t, func() bool {
+			return sb.GetMetrics().FramesProcessed == 2
+		}, time.Second, time.Millisecond)
+
+		snapshot, err := sb.GetSnapshot(context.Background())
+		require.NoError(t, err)
+		require.Len(t, snapshot.Frames, 2)
+		assert.Equal(t, "Frame 1", string(snapshot.Frames[0].Data), "older capture time should sort first")
+		assert.True(t, capture.Equal(snapshot.Frames[0].Timestamp), "should keep the capture timestamp")
+	})
+
+	t.Run("Times out when input is full", func(t *testing.T) {
+		var drops dropRecorder
+		sb := NewStreamBuffer(WithInputBuffer(1), WithDropHandler(drops.record))
+
+		require.NoError(t, sb.Push(context.Background(), []byte("Frame 0")))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		err := sb.Push(ctx, []byte("Frame 1"))
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, uint64(1), sb.GetMetrics().FramesDropped)
+		assert.Equal(t, []DropReason{DropInputFull}, drops.get())
+	})
+
+	t.Run("Rejects oversize frames", func(t *testing.T) {
+		sb := NewStreamBuffer(WithMaxFrameSize(4))
+
+		err := sb.Push(context.Background(), []byte("too large"))
+		assert.ErrorIs(t, err, ErrFrameTooLarge)
+		assert.Equal(t, uint64(1), sb.GetMetrics().FramesDropped)
+	})
+
+	t.Run("Unblocks on stop", func(t *testing.T) {
+		sb := NewStreamBuffer(WithInputBuffer(1))
+		sb.Start()
+		sb.Stop()
+
+		err := sb.Push(context.Background(), []byte("Frame 0"))
+		assert.ErrorIs(t, err, ErrStopped)
+		assert.Equal(t, uint64(1), sb.GetMetrics().FramesDropped)
+	})
+}
+
+func TestStreamBufferBackpressure(t *testing.T) {
+	// pushes five frames into an unstarted buffer with room for two
+	pushAll := func(t *testing.T, sb *StreamBuffer) []error {
+		t.Helper()
+
+		var errs []error
+		for i := range 5 {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			errs = append(errs, sb.Push(ctx, fmt.Appendf(nil, "Frame %d", i)))
+			cancel()
+		}
+		return errs
+	}
+
+	queued := func(sb *StreamBuffer) []string {
+		var data []string
+		for len(sb.queue) > 0 {
+			data = append(data, string((<-sb.queue).Data))
+		}
+		return data
+	}
+
+	t.Run("Block", func(t *testing.T) {
+		sb := NewStreamBuffer(WithInputBuffer(2), WithBackpressure(BackpressureBlock))
+
+		errs := pushAll(t, sb)
+		assert.NoError(t, errs[0])
+		assert.NoError(t, errs[1])
+		for _, err := range errs[2:] {
+			assert.ErrorIs(t, err, context.DeadlineExceeded)
+		}
+		assert.False(t, sb.TryPush([]byte("Frame 5")), "TryPush should not wait")
+
+		assert.Equal(t, []string{"Frame 0", "Frame 1"}, queued(sb))
+
+		metrics := sb.GetMetrics()
+		assert.Equal(t, uint64(3), metrics.PushesBlocked)
+		assert.Equal(t, uint64(4), metrics.DroppedNewest)
+		assert.Equal(t, uint64(4), metrics.FramesDropped)
+	})
+
+	t.Run("DropNewest", func(t *testing.T) {
+		sb := NewStreamBuffer(WithInputBuffer(2), WithBackpressure(BackpressureDropNewest))
+
+		errs := pushAll(t, sb)
+		for _, err := range errs[2:] {
+			assert.ErrorIs(t, err, ErrInputFull)
+		}
+
+		assert.Equal(t, []string{"Frame 0", "Frame 1"}, queued(sb))
+
+		metrics := sb.GetMetrics()
+		assert.Equal(t, uint64(0), metrics.PushesBlocked)
+		assert.Equal(t, uint64(3), metrics.DroppedNewest)
+		assert.Equal(t, uint64(3), metrics.FramesDropped)
+	})
+
+	t.Run("DropOldest", func(t *testing.T) {
+		var drops dropRecorder
+		sb := NewStreamBuffer(
+			WithInputBuffer(2),
+			WithBackpressure(BackpressureDropOldest),
+			WithDropHandler(drops.record),
+		)
+
+		for _, err := range pushAll(t, sb) {
+			assert.NoError(t, err)
+		}
+		assert.True(t, sb.TryPush([]byte("Frame 5")))
+
+		assert.Equal(t, []string{"Frame 4", "Frame 5"}, queued(sb))
+
+		metrics := sb.GetMetrics()
+		assert.Equal(t, uint64(4), metrics.DroppedOldest)
+		assert.Equal(t, uint64(4), metrics.FramesDropped)
+		assert.Equal(t, []DropReason{DropDisplaced, DropDisplaced, DropDisplaced, DropDisplaced}, drops.get())
+	})
+
+	t.Run("Sample", func(t *testing.T) {
+		sb := NewStreamBuffer(
+			WithInputBuffer(2),
+			WithBackpressure(BackpressureSample),
+			WithSampleEvery(2),
+		)
+
+		errs := pushAll(t, sb)
+		assert.ErrorIs(t, errs[2], ErrInputFull, "should skip the first frame while full")
+		assert.NoError(t, errs[3], "should keep the second frame while full")
+		assert.ErrorIs(t, errs[4], ErrInputFull, "should skip the third frame while full")
+
+		// frames 2 and 4 are sampled out, frame 3 displaces frame 0
+		assert.Equal(t, []string{"Frame 1", "Frame 3"}, queued(sb))
+
+		metrics := sb.GetMetrics()
+		assert.Equal(t, uint64(2), metrics.SampledOut)
+		assert.Equal(t, uint64(1), metrics.DroppedOldest)
+		assert.Equal(t, uint64(3), metrics.FramesDropped)
+	})
+}
+
+func TestStreamBufferInputBackpressure(t *testing.T) {
+	var drops dropRecorder
+	sb := NewStreamBuffer(
+		WithInputBuffer(2),
+		WithMaxFrameSize(16),
+		WithBackpressure(BackpressureDropNewest),
+		WithDropHandler(drops.record),
+	)
+
+	// forward the input channels without processing, so the queue fills up
+	stop := make(chan struct{})
+	defer close(stop)
+	go sb.forwardInput(stop)
+
+	for i := range 4 {
+		sb.Input() <- fmt.Appendf(nil, "Frame %d", i)
+	}
+	require.Eventually(t, func() bool {
+		return sb.GetMetrics().FramesDropped == 2
+	}, time.Second, time.Millisecond)
+
+	sb.InputFrames() <- Frame{Data: make([]byte, 17)}
+
+	require.Eventually(t, func() bool {
+		return sb.GetMetrics().FramesDropped == 3
+	}, time.Second, time.Millisecond)
+
+	var queued []string
+	for len(sb.queue) > 0 {
+		queued = append(queued, string((<-sb.queue).Data))
+	}
+	assert.Equal(t, []string{"Frame 0", "Frame 1"}, queued)
+	assert.Equal(t, uint64(2), sb.GetMetrics().DroppedNewest)
+	assert.Equal(t, []DropReason{DropInputFull, DropInputFull, DropOversize}, drops.get())
+}
+
+func TestDropReasonString(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "input full", DropInputFull.String())
+	assert.Equal(t, "stopped", DropStopped.String())
+	assert.Equal(t, "oversize", DropOversize.String())
+	assert.Equal(t, "displaced", DropDisplaced.String())
+	assert.Equal(t, "sampled", DropSampled.String())
+	assert.Equal(t, "unknown", DropReason(-1).String())
+}
@@ -0,0 +1,259 @@
+package tidstrom
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"sort"
+	"time"
+)
+
+// snapshotQuery selects which buffered frames a snapshot contains.
+type snapshotQuery struct {
+	from, to time.Time // inclusive timestamp bounds, zero for unbounded
+	since    uint64    // lowest sequence to include when hasSince is set
+	hasSince bool
+	until    uint64 // highest sequence to include when hasUntil is set
+	hasUntil bool
+	last     int                 // keep only the newest matching frames, 0 for all
+	metadata Metadata            // required frame attributes, nil for any
+	where    []func(*Frame) bool // predicates every selected frame satisfies
+	keyframe bool                // start at the keyframe preceding the first selected frame
+}
+
+// SnapshotOption customizes the frames selected by GetSnapshot and GetRange.
+// Options are applied to the buffered frames before any data is copied, so
+// filtered-out frames cost nothing. All filters must match for a frame to be
+// selected; Limit is applied last.
+type SnapshotOption func(*snapshotQuery)
+
+// Where selects frames for which keep returns true. keep may be called with
+// the buffer locked: it must not modify or retain the frame, and must not
+// call the buffer's methods.
+func Where(keep func(f *Frame) bool) SnapshotOption {
+	return func(q *snapshotQuery) {
+		if keep != nil {
+			q.where = append(q.where, keep)
+		}
+	}
+}
+
+// TimeRange selects frames with timestamps between from and to, inclusive.
+// A zero from or to leaves that end of the range open.
+func TimeRange(from, to time.Time) SnapshotOption {
+	return func(q *snapshotQuery) {
+		q.from, q.to = from, to
+	}
+}
+
+// SequenceRange selects frames with a Sequence between from and to, inclusive.
+func SequenceRange(from, to uint64) SnapshotOption {
+	return func(q *snapshotQuery) {
+		q.since, q.hasSince = from, true
+		q.until, q.hasUntil = to, true
+	}
+}
+
+// MatchMetadata selects frames whose metadata contains every key/value pair in want.
+func MatchMetadata(want Metadata) SnapshotOption {
+	return func(q *snapshotQuery) {
+		if len(want) == 0 {
+			return
+		}
+		merged := q.metadata.clone()
+		if merged == nil {
+			merged = make(Metadata, len(want))
+		}
+		maps.Copy(merged, want)
+		q.metadata = merged
+	}
+}
+
+// Limit keeps only the newest n selected frames. A non-positive n is ignored.
+func Limit(n int) SnapshotOption {
+	return func(q *snapshotQuery) {
+		if n > 0 {
+			q.last = n
+		}
+	}
+}
+
+// FromKeyframe extends the start of a snapshot back to the nearest preceding
+// keyframe, so that it can be decoded. If no keyframe precedes it, the
+// snapshot starts at the first keyframe in range instead, and is empty if
+// there is none.
+func FromKeyframe() SnapshotOption {
+	return func(q *snapshotQuery) {
+		q.keyframe = true
+	}
+}
+
+// newSnapshotQuery returns a query with opts applied.
+func newSnapshotQuery(opts []SnapshotOption) snapshotQuery {
+	var q snapshotQuery
+	for _, opt := range opts {
+		opt(&q)
+	}
+	return q
+}
+
+// snapshotResult is the processing loop's answer to a snapshot request.
+type snapshotResult struct {
+	snapshot *Snapshot
+	gap      bool           // frames at or after the requested sequence were evicted
+	err      error          // spilled frames could not be read
+	spilled  []spilledFrame // snapshot frames whose data is still on disk
+}
+
+// match reports whether a frame within the query bounds is selected.
+func (q snapshotQuery) match(f *Frame) bool {
+	if q.hasSince && f.Sequence < q.since {
+		return false
+	}
+	if q.hasUntil && f.Sequence > q.until {
+		return false
+	}
+	if !f.Metadata.Matches(q.metadata) {
+		return false
+	}
+	for _, keep := range q.where {
+		if !keep(f) {
+			return false
+		}
+	}
+	return true
+}
+
+// frameList is a timestamp-ordered sequence of frames that a query selects from:
+// the buffer itself, or buffered frames merged with spilled ones.
+type frameList interface {
+	frameCount() int
+	frameAt(i int) *Frame
+}
+
+// frameSlice is a frameList backed by a slice.
+type frameSlice []Frame
+
+func (s frameSlice) frameCount() int      { return len(s) }
+func (s frameSlice) frameAt(i int) *Frame { return &s[i] }
+
+// selectFrames returns the positions of the frames in l selected by q, oldest first.
+// If l is the buffer, sb.mu must be held.
+func (q snapshotQuery) selectFrames(l frameList) []int {
+	lo, hi := q.bounds(l)
+	if lo >= hi {
+		return nil
+	}
+
+	selected := make([]int, 0, hi-lo)
+	for i := lo; i < hi; i++ {
+		if q.match(l.frameAt(i)) {
+			selected = append(selected, i)
+		}
+	}
+	if q.last > 0 && len(selected) > q.last {
+		selected = selected[len(selected)-q.last:]
+	}
+	return selected
+}
+
+// hasGap reports whether any frame sequenced at or after q.since, and before
+// nextSeq, is missing from l. If l is the buffer, sb.mu must be held.
+func (q snapshotQuery) hasGap(l frameList, nextSeq uint64) bool {
+	if !q.hasSince || q.since >= nextSeq {
+		return false
+	}
+
+	var retained uint64
+	for i := range l.frameCount() {
+		if l.frameAt(i).Sequence >= q.since {
+			retained++
+		}
+	}
+	return retained < nextSeq-q.since
+}
+
+// bounds returns the range [lo, hi) of positions in l matching the query.
+// Frames are ordered by timestamp, so both ends are found by binary search.
+// If l is the buffer, sb.mu must be held.
+func (q snapshotQuery) bounds(l frameList) (int, int) {
+	n := l.frameCount()
+	lo, hi := 0, n
+	if !q.from.IsZero() {
+		lo = sort.Search(n, func(i int) bool {
+			return !l.frameAt(i).Timestamp.Before(q.from)
+		})
+	}
+	if !q.to.IsZero() {
+		hi = sort.Search(n, func(i int) bool {
+			return l.frameAt(i).Timestamp.After(q.to)
+		})
+	}
+	if q.keyframe && lo < hi {
+		lo = keyframeStart(l, lo, hi)
+	}
+	return lo, hi
+}
+
+// keyframeStart returns the position of the keyframe a range starting at lo
+// should be extended to: the nearest one at or before lo, else the first one
+// before hi. It returns hi if there is none.
+func keyframeStart(l frameList, lo, hi int) int {
+	if k := keyframeAtOrBefore(l, lo); k >= 0 {
+		return k
+	}
+	for i := lo + 1; i < hi; i++ {
+		if l.frameAt(i).Keyframe {
+			return i
+		}
+	}
+	return hi
+}
+
+// keyframeAtOrBefore returns the position of the nearest keyframe in l at
+// or before pos, or -1 if there is none.
+func keyframeAtOrBefore(l frameList, pos int) int {
+	for i := pos; i >= 0; i-- {
+		if l.frameAt(i).Keyframe {
+			return i
+		}
+	}
+	return -1
+}
+
+// GetRange returns a copy of the frames with timestamps between from and to, inclusive.
+// A zero from or to leaves that end of the range open. Only matching frames are copied.
+func (sb *StreamBuffer) GetRange(ctx context.Context, from, to time.Time, opts ...SnapshotOption) (*Snapshot, error) {
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return nil, errors.New("range end is before range start")
+	}
+	q := newSnapshotQuery(opts)
+	q.from, q.to = from, to
+	return sb.requestSnapshot(ctx, q)
+}
+
+// GetMatching returns a copy of the frames whose metadata contains every
+// key/value pair in want, ordered by timestamp.
+func (sb *StreamBuffer) GetMatching(ctx context.Context, want Metadata) (*Snapshot, error) {
+	return sb.requestSnapshot(ctx, snapshotQuery{metadata: want})
+}
+
+// GetSince returns a copy of the frames with a Sequence of seq or higher, ordered by timestamp.
+// To resume polling, pass one past the highest sequence seen so far.
+// The returned flag reports a gap: some of those frames were evicted before
+// they could be read.
+func (sb *StreamBuffer) GetSince(ctx context.Context, seq uint64) (*Snapshot, bool, error) {
+	result, err := sb.requestSnapshotResult(ctx, snapshotQuery{since: seq, hasSince: true})
+	if err != nil {
+		return nil, false, err
+	}
+	return result.snapshot, result.gap, nil
+}
+
+// GetLast returns a copy of the newest n frames, ordered by timestamp.
+func (sb *StreamBuffer) GetLast(ctx context.Context, n int) (*Snapshot, error) {
+	if n <= 0 {
+		return nil, errors.New("frame count must be positive")
+	}
+	return sb.requestSnapshot(ctx, snapshotQuery{last: n})
+}
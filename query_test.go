@@ -0,0 +1,244 @@
+package tidstrom
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// frameData returns the data of each frame as a string.
+func frameData(frames []Frame) []string {
+	data := make([]string, 0, len(frames))
+	for _, frame := range frames {
+		data = append(data, string(frame.Data))
+	}
+	return data
+}
+
+func TestStreamBufferGetRange(t *testing.T) {
+	sb, _, base := newTestBuffer(t)
+	ctx := context.Background()
+
+	testCases := []struct {
+		name     string
+		from, to time.Time
+		expected []string
+	}{
+		{
+			name:     "Closed range",
+			from:     base.Add(2 * time.Second),
+			to:       base.Add(4500 * time.Millisecond),
+			expected: []string{"Frame 2", "Frame 3", "Frame 4"},
+		},
+		{
+			name:     "Open start",
+			to:       base.Add(time.Second),
+			expected: []string{"Frame 0", "Frame 1"},
+		},
+		{
+			name:     "Open end",
+			from:     base.Add(8500 * time.Millisecond),
+			expected: []string{"Frame 9"},
+		},
+		{
+			name:     "Single instant",
+			from:     base.Add(5 * time.Second),
+			to:       base.Add(5 * time.Second),
+			expected: []string{"Frame 5"},
+		},
+		{
+			name:     "No matching frames",
+			from:     base.Add(time.Minute),
+			expected: []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			snapshot, err := sb.GetRange(ctx, tc.from, tc.to)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expected, frameData(snapshot.Frames))
+			if len(snapshot.Frames) > 0 {
+				assert.Equal(t, snapshot.Frames[0].Timestamp, snapshot.StartTime)
+				assert.Equal(t, snapshot.Frames[len(snapshot.Frames)-1].Timestamp, snapshot.EndTime)
+			} else {
+				assert.True(t, snapshot.StartTime.IsZero())
+				assert.True(t, snapshot.EndTime.IsZero())
+			}
+		})
+	}
+
+	t.Run("Inverted range", func(t *testing.T) {
+		_, err := sb.GetRange(ctx, base.Add(time.Second), base)
+		assert.Error(t, err)
+	})
+}
+
+func TestStreamBufferGetSince(t *testing.T) {
+	// capacity of 8 evicts frames 0 and 1
+	sb, _, _ := newTestBuffer(t, WithCapacity(8))
+	ctx := context.Background()
+
+	testCases := []struct {
+		name        string
+		seq         uint64
+		expected    []string
+		expectedGap bool
+	}{
+		{
+			name:        "Evicted sequence",
+			seq:         0,
+			expected:    []string{"Frame 2", "Frame 3", "Frame 4", "Frame 5", "Frame 6", "Frame 7", "Frame 8", "Frame 9"},
+			expectedGap: true,
+		},
+		{
+			name:     "Oldest retained sequence",
+			seq:      2,
+			expected: []string{"Frame 2", "Frame 3", "Frame 4", "Frame 5", "Frame 6", "Frame 7", "Frame 8", "Frame 9"},
+		},
+		{
+			name:     "Recent sequence",
+			seq:      7,
+			expected: []string{"Frame 7", "Frame 8", "Frame 9"},
+		},
+		{
+			name:     "Future sequence",
+			seq:      10,
+			expected: []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			snapshot, gap, err := sb.GetSince(ctx, tc.seq)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expected, frameData(snapshot.Frames))
+			assert.Equal(t, tc.expectedGap, gap)
+			for _, frame := range snapshot.Frames {
+				assert.GreaterOrEqual(t, frame.Sequence, tc.seq)
+			}
+		})
+	}
+}
+
+func TestStreamBufferGetLast(t *testing.T) {
+	sb, _, _ := newTestBuffer(t)
+	ctx := context.Background()
+
+	snapshot, err := sb.GetLast(ctx, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Frame 7", "Frame 8", "Frame 9"}, frameData(snapshot.Frames))
+	assert.Equal(t, snapshot.Frames[0].Timestamp, snapshot.StartTime)
+	assert.Equal(t, snapshot.Frames[2].Timestamp, snapshot.EndTime)
+
+	snapshot, err = sb.GetLast(ctx, 100)
+	require.NoError(t, err)
+	assert.Len(t, snapshot.Frames, 10, "should return all frames when fewer than n are buffered")
+
+	_, err = sb.GetLast(ctx, 0)
+	assert.Error(t, err)
+}
+
+func TestStreamBufferSnapshotOptions(t *testing.T) {
+	sb, _, base := newTestBuffer(t)
+	ctx := context.Background()
+
+	even := Where(func(f *Frame) bool { return f.Sequence%2 == 0 })
+
+	testCases := []struct {
+		name     string
+		opts     []SnapshotOption
+		expected []string
+	}{
+		{
+			name:     "No options",
+			expected: []string{"Frame 0", "Frame 1", "Frame 2", "Frame 3", "Frame 4", "Frame 5", "Frame 6", "Frame 7", "Frame 8", "Frame 9"},
+		},
+		{
+			name:     "Predicate",
+			opts:     []SnapshotOption{even},
+			expected: []string{"Frame 0", "Frame 2", "Frame 4", "Frame 6", "Frame 8"},
+		},
+		{
+			name: "Predicate on data",
+			opts: []SnapshotOption{Where(func(f *Frame) bool {
+				return string(f.Data) == "Frame 7"
+			})},
+			expected: []string{"Frame 7"},
+		},
+		{
+			name:     "Time range",
+			opts:     []SnapshotOption{TimeRange(base.Add(3*time.Second), base.Add(5*time.Second))},
+			expected: []string{"Frame 3", "Frame 4", "Frame 5"},
+		},
+		{
+			name:     "Sequence range",
+			opts:     []SnapshotOption{SequenceRange(6, 8)},
+			expected: []string{"Frame 6", "Frame 7", "Frame 8"},
+		},
+		{
+			name:     "Empty sequence range",
+			opts:     []SnapshotOption{SequenceRange(8, 6)},
+			expected: []string{},
+		},
+		{
+			name:     "Limit keeps the newest",
+			opts:     []SnapshotOption{Limit(3)},
+			expected: []string{"Frame 7", "Frame 8", "Frame 9"},
+		},
+		{
+			name:     "Limit applies after filters",
+			opts:     []SnapshotOption{Limit(2), even, TimeRange(time.Time{}, base.Add(5*time.Second))},
+			expected: []string{"Frame 2", "Frame 4"},
+		},
+		{
+			name: "Filters combine",
+			opts: []SnapshotOption{
+				SequenceRange(2, 9),
+				even,
+				Where(func(f *Frame) bool { return f.Sequence != 4 }),
+			},
+			expected: []string{"Frame 2", "Frame 6", "Frame 8"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			snapshot, err := sb.GetSnapshot(ctx, tc.opts...)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, frameData(snapshot.Frames))
+			snapshot.Release()
+		})
+	}
+}
+
+func TestStreamBufferMatchMetadata(t *testing.T) {
+	sb := NewStreamBuffer()
+	sb.Start()
+	defer sb.Stop()
+
+	ctx := context.Background()
+	for i, md := range []Metadata{
+		{"source": "cam-1", "codec": "h264"},
+		{"source": "cam-2", "codec": "h264"},
+		{"source": "cam-1", "codec": "h265"},
+	} {
+		require.NoError(t, sb.PushFrame(ctx, Frame{Data: fmt.Appendf(nil, "Frame %d", i), Metadata: md}))
+	}
+	require.Eventually(t, func() bool {
+		return sb.GetMetrics().FramesProcessed == 3
+	}, time.Second, time.Millisecond)
+
+	snapshot, err := sb.GetSnapshot(ctx,
+		MatchMetadata(Metadata{"source": "cam-1"}),
+		MatchMetadata(Metadata{"codec": "h264"}),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Frame 0"}, frameData(snapshot.Frames))
+}
@@ -0,0 +1,306 @@
+package tidstrom
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"slices"
+	"time"
+)
+
+// Segment files start with a fixed header followed by frame records:
+//
+//	header: magic "TDSG" | version uint8 | 3 reserved bytes
+//	record: body length uint32 | CRC-32 (IEEE) of body uint32 | body
+//	body:   sequence uint64 | timestamp int64 (Unix ns) | flags uint8 |
+//	        uvarint ID length | ID | uvarint metadata count |
+//	        (uvarint key length | key | uvarint value length | value)... |
+//	        data
+//
+// Integers are little-endian. A record that is truncated or fails its
+// checksum ends the segment, so a crash mid-write loses at most that record.
+const (
+	segmentMagic      = "TDSG"
+	segmentVersion    = 1
+	segmentHeaderSize = 8
+	recordHeaderSize  = 8
+	recordFixedSize   = 17 // sequence, timestamp and flags
+
+	flagKeyframe = 1 << 0
+)
+
+// errCorruptRecord reports a record that cannot be decoded.
+var errCorruptRecord = errors.New("corrupt segment record")
+
+// segmentEntry locates one frame record in a segment file. Everything but the
+// frame data is kept in memory so queries can select frames without reading
+// the file.
+type segmentEntry struct {
+	id        string
+	timestamp time.Time
+	sequence  uint64
+	keyframe  bool
+	metadata  Metadata
+	seg       *segment
+	offset    int64 // position of the frame data in the file
+	size      int   // frame data length
+}
+
+// frame returns the frame described by e, without its data.
+func (e *segmentEntry) frame() Frame {
+	return Frame{
+		ID:        e.id,
+		Timestamp: e.timestamp,
+		Sequence:  e.sequence,
+		Metadata:  e.metadata.clone(),
+		Keyframe:  e.keyframe,
+	}
+}
+
+// segment is an append-only file of frame records.
+type segment struct {
+	path    string
+	file    *os.File
+	size    int64 // bytes written, including the header
+	entries []segmentEntry
+	start   time.Time // earliest frame timestamp
+	end     time.Time // latest frame timestamp
+}
+
+// createSegment creates a new, empty segment file at path.
+func createSegment(path string) (*segment, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, segmentHeaderSize)
+	copy(header, segmentMagic)
+	header[4] = segmentVersion
+	if _, err := file.Write(header); err != nil {
+		file.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	return &segment{path: path, file: file, size: segmentHeaderSize}, nil
+}
+
+// openSegment opens an existing segment file and indexes its records,
+// stopping at the first record that is truncated or corrupt.
+func openSegment(path string) (*segment, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	seg := segment{path: path, file: file}
+	if err := seg.scan(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("segment %s: %w", path, err)
+	}
+	return &seg, nil
+}
+
+// scan reads the segment header and indexes every intact record.
+func (s *segment) scan() error {
+	header := make([]byte, segmentHeaderSize)
+	if _, err := s.file.ReadAt(header, 0); err != nil {
+		return fmt.Errorf("reading header: %w", err)
+	}
+	if string(header[:4]) != segmentMagic {
+		return errors.New("not a segment file")
+	}
+	if header[4] != segmentVersion {
+		return fmt.Errorf("unsupported segment version %d", header[4])
+	}
+
+	info, err := s.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	offset := int64(segmentHeaderSize)
+	recordHeader := make([]byte, recordHeaderSize)
+	var body []byte
+	for {
+		if _, err := s.file.ReadAt(recordHeader, offset); err != nil {
+			break // end of segment or truncated header
+		}
+		size := binary.LittleEndian.Uint32(recordHeader)
+		sum := binary.LittleEndian.Uint32(recordHeader[4:])
+		if int64(size) > info.Size()-offset-recordHeaderSize {
+			break // truncated body
+		}
+
+		body = grow(body, int(size))
+		if _, err := s.file.ReadAt(body, offset+recordHeaderSize); err != nil {
+			break
+		}
+		if crc32.ChecksumIEEE(body) != sum {
+			break
+		}
+
+		e, dataStart, err := decodeRecord(body)
+		if err != nil {
+			break
+		}
+		e.offset = offset + recordHeaderSize + int64(dataStart)
+		s.add(e)
+		offset += recordHeaderSize + int64(size)
+	}
+	s.size = offset
+	return nil
+}
+
+// append writes a frame record and indexes it.
+func (s *segment) append(f *Frame) error {
+	record := encodeRecord(f)
+	if _, err := s.file.WriteAt(record, s.size); err != nil {
+		return err
+	}
+
+	e := segmentEntry{
+		id:        f.ID,
+		timestamp: f.Timestamp,
+		sequence:  f.Sequence,
+		keyframe:  f.Keyframe,
+		metadata:  f.Metadata.clone(),
+		offset:    s.size + int64(len(record)-len(f.Data)),
+		size:      len(f.Data),
+	}
+	s.size += int64(len(record))
+	s.add(e)
+	return nil
+}
+
+// add indexes a record and widens the segment's time range.
+func (s *segment) add(e segmentEntry) {
+	e.seg = s
+	if len(s.entries) == 0 || e.timestamp.Before(s.start) {
+		s.start = e.timestamp
+	}
+	if len(s.entries) == 0 || e.timestamp.After(s.end) {
+		s.end = e.timestamp
+	}
+	s.entries = append(s.entries, e)
+}
+
+// read returns the data of the frame at e, appended to dst.
+func (s *segment) read(dst []byte, e *segmentEntry) ([]byte, error) {
+	n := len(dst)
+	dst = slices.Grow(dst, e.size)[:n+e.size]
+	if _, err := s.file.ReadAt(dst[n:], e.offset); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return dst[:n], err
+	}
+	return dst, nil
+}
+
+// encodeRecord returns the framed record for f.
+func encodeRecord(f *Frame) []byte {
+	return append(encodeRecordPrefix(f, len(f.Data)), f.Data...)
+}
+
+// encodeRecordPrefix returns the framed record for f up to its data, which
+// follows it. The length and checksum cover the data, so it can be written
+// separately without being copied. extra is the spare capacity to allocate.
+func encodeRecordPrefix(f *Frame, extra int) []byte {
+	size := recordFixedSize + binary.MaxVarintLen64*(2+2*len(f.Metadata)) + len(f.ID) + extra
+	for k, v := range f.Metadata {
+		size += len(k) + len(v)
+	}
+
+	record := make([]byte, recordHeaderSize, recordHeaderSize+size)
+	record = binary.LittleEndian.AppendUint64(record, f.Sequence)
+	record = binary.LittleEndian.AppendUint64(record, uint64(f.Timestamp.UnixNano()))
+
+	var flags byte
+	if f.Keyframe {
+		flags |= flagKeyframe
+	}
+	record = append(record, flags)
+
+	record = appendString(record, f.ID)
+	record = binary.AppendUvarint(record, uint64(len(f.Metadata)))
+	for k, v := range f.Metadata {
+		record = appendString(record, k)
+		record = appendString(record, v)
+	}
+
+	body := record[recordHeaderSize:]
+	binary.LittleEndian.PutUint32(record, uint32(len(body)+len(f.Data)))
+	binary.LittleEndian.PutUint32(record[4:], crc32.Update(crc32.ChecksumIEEE(body), crc32.IEEETable, f.Data))
+	return record
+}
+
+// decodeRecord decodes a record body into an entry and returns the position
+// at which the frame data starts.
+func decodeRecord(body []byte) (segmentEntry, int, error) {
+	if len(body) < recordFixedSize {
+		return segmentEntry{}, 0, errCorruptRecord
+	}
+
+	e := segmentEntry{
+		sequence:  binary.LittleEndian.Uint64(body),
+		timestamp: time.Unix(0, int64(binary.LittleEndian.Uint64(body[8:]))).UTC(),
+		keyframe:  body[16]&flagKeyframe != 0,
+	}
+
+	pos := recordFixedSize
+	var err error
+	if e.id, pos, err = readString(body, pos); err != nil {
+		return segmentEntry{}, 0, err
+	}
+
+	count, n := binary.Uvarint(body[pos:])
+	if n <= 0 || count > uint64(len(body)) {
+		return segmentEntry{}, 0, errCorruptRecord
+	}
+	pos += n
+	if count > 0 {
+		e.metadata = make(Metadata, count)
+	}
+	for range count {
+		var k, v string
+		if k, pos, err = readString(body, pos); err != nil {
+			return segmentEntry{}, 0, err
+		}
+		if v, pos, err = readString(body, pos); err != nil {
+			return segmentEntry{}, 0, err
+		}
+		e.metadata[k] = v
+	}
+
+	e.size = len(body) - pos
+	return e, pos, nil
+}
+
+// appendString appends a uvarint length-prefixed string.
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// readString reads a uvarint length-prefixed string at pos and returns the
+// position following it.
+func readString(b []byte, pos int) (string, int, error) {
+	n, w := binary.Uvarint(b[pos:])
+	if w <= 0 || n > uint64(len(b)-pos-w) {
+		return "", 0, errCorruptRecord
+	}
+	pos += w
+	return string(b[pos : pos+int(n)]), pos + int(n), nil
+}
+
+// grow returns b resized to n bytes, reallocating only if needed.
+func grow(b []byte, n int) []byte {
+	if cap(b) < n {
+		return make([]byte, n)
+	}
+	return b[:n]
+}
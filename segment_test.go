@@ -0,0 +1,124 @@
+package tidstrom
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSegmentRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.seg")
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	frames := []Frame{
+		{
+			ID:        "a",
+			Data:      []byte("first frame"),
+			Timestamp: base,
+			Sequence:  7,
+			Metadata:  Metadata{"codec": "h264", "width": "1920"},
+			Keyframe:  true,
+		},
+		{ID: "b", Data: []byte{}, Timestamp: base.Add(time.Second), Sequence: 8},
+		{ID: "c", Data: []byte("third"), Timestamp: base.Add(-time.Second), Sequence: 9},
+	}
+
+	seg, err := createSegment(path)
+	require.NoError(t, err)
+	for i := range frames {
+		require.NoError(t, seg.append(&frames[i]))
+	}
+	require.NoError(t, seg.file.Close())
+
+	reopened, err := openSegment(path)
+	require.NoError(t, err)
+	defer reopened.file.Close()
+
+	require.Len(t, reopened.entries, len(frames))
+	assert.Equal(t, seg.size, reopened.size)
+	assert.True(t, reopened.start.Equal(base.Add(-time.Second)))
+	assert.True(t, reopened.end.Equal(base.Add(time.Second)))
+
+	for i, e := range reopened.entries {
+		f := e.frame()
+		f.Data, err = reopened.read(nil, &e)
+		require.NoError(t, err)
+
+		assert.Equal(t, frames[i].ID, f.ID)
+		assert.Equal(t, frames[i].Sequence, f.Sequence)
+		assert.True(t, frames[i].Timestamp.Equal(f.Timestamp))
+		assert.Equal(t, frames[i].Keyframe, f.Keyframe)
+		assert.Equal(t, frames[i].Metadata, f.Metadata)
+		assert.Equal(t, string(frames[i].Data), string(f.Data))
+	}
+}
+
+func TestSegmentTruncatedTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.seg")
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	seg, err := createSegment(path)
+	require.NoError(t, err)
+	for i := range 3 {
+		require.NoError(t, seg.append(&Frame{
+			ID:        "frame",
+			Data:      []byte("payload"),
+			Timestamp: base.Add(time.Duration(i) * time.Second),
+			Sequence:  uint64(i),
+		}))
+	}
+	require.NoError(t, seg.file.Close())
+
+	testCases := []struct {
+		name     string
+		corrupt  func(data []byte) []byte
+		expected int
+	}{
+		{
+			name:     "Truncated record",
+			corrupt:  func(data []byte) []byte { return data[:len(data)-3] },
+			expected: 2,
+		},
+		{
+			name: "Checksum mismatch",
+			corrupt: func(data []byte) []byte {
+				data[len(data)-1] ^= 0xff
+				return data
+			},
+			expected: 2,
+		},
+		{
+			name:     "Partial header",
+			corrupt:  func(data []byte) []byte { return append(data, 1, 2, 3) },
+			expected: 3,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+
+			corrupted := filepath.Join(t.TempDir(), "corrupted.seg")
+			require.NoError(t, os.WriteFile(corrupted, tc.corrupt(data), 0o644))
+
+			reopened, err := openSegment(corrupted)
+			require.NoError(t, err)
+			defer reopened.file.Close()
+
+			assert.Len(t, reopened.entries, tc.expected)
+		})
+	}
+
+	t.Run("Not a segment", func(t *testing.T) {
+		other := filepath.Join(t.TempDir(), "other.seg")
+		require.NoError(t, os.WriteFile(other, []byte("not a segment file"), 0o644))
+
+		_, err := openSegment(other)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,373 @@
+package tidstrom
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+// Snapshot files are self-describing and can be written and read as a stream:
+//
+//	header: magic "TDSN" | version uint8 | 3 reserved bytes |
+//	        uvarint ID length | ID | creation time int64 (Unix ns)
+//	frames: one record per frame, encoded as in segment files
+//	index:  marker 0xFFFFFFFF | frame count uint64 |
+//	        (offset uint64 | sequence uint64 | timestamp int64 | size uint32)...
+//	footer: index offset uint64 | CRC-32 (IEEE) of all preceding bytes uint32 |
+//	        magic "TDSN"
+//
+// Integers are little-endian. The index, at the end so that frames can be
+// written as they arrive, locates each frame record by its byte offset.
+const (
+	snapshotMagic      = "TDSN"
+	snapshotVersion    = 1
+	snapshotIndexMark  = 0xFFFFFFFF
+	snapshotIndexSize  = 28
+	snapshotFooterSize = 16
+
+	// maxSnapshotRecord bounds the record size a reader will allocate.
+	maxSnapshotRecord = 1 << 30
+)
+
+// ErrCorruptSnapshot is returned when reading a snapshot file that is
+// malformed, truncated or fails its checksum.
+var ErrCorruptSnapshot = errors.New("corrupt snapshot file")
+
+// snapshotIndex locates a frame record in a snapshot file.
+type snapshotIndex struct {
+	offset    uint64
+	sequence  uint64
+	timestamp int64
+	size      uint32 // frame data length
+}
+
+// SnapshotWriter writes a snapshot file one frame at a time, holding only
+// the frame index in memory.
+type SnapshotWriter struct {
+	w      io.Writer
+	crc    hash.Hash32
+	offset uint64
+	index  []snapshotIndex
+	err    error // first write error, repeated by later calls
+	closed bool
+}
+
+// NewSnapshotWriter writes the header of a snapshot file with the given ID
+// and creation time to w and returns a writer for its frames.
+func NewSnapshotWriter(w io.Writer, id string, created time.Time) (*SnapshotWriter, error) {
+	sw := SnapshotWriter{w: w, crc: crc32.NewIEEE()}
+
+	header := make([]byte, 8, 8+binary.MaxVarintLen64+len(id)+8)
+	copy(header, snapshotMagic)
+	header[4] = snapshotVersion
+	header = appendString(header, id)
+	header = binary.LittleEndian.AppendUint64(header, uint64(created.UnixNano()))
+
+	if err := sw.write(header); err != nil {
+		return nil, err
+	}
+	return &sw, nil
+}
+
+// WriteFrame appends a frame. Frames should be written in timestamp order.
+// A frame whose record would be too large for readers to accept is
+// rejected, leaving the writer usable.
+func (sw *SnapshotWriter) WriteFrame(f Frame) error {
+	if sw.closed {
+		return errors.New("snapshot writer is closed")
+	}
+
+	prefix := encodeRecordPrefix(&f, 0)
+	if len(prefix)-recordHeaderSize+len(f.Data) > maxSnapshotRecord {
+		return errors.New("frame too large for a snapshot file")
+	}
+
+	sw.index = append(sw.index, snapshotIndex{
+		offset:    sw.offset,
+		sequence:  f.Sequence,
+		timestamp: f.Timestamp.UnixNano(),
+		size:      uint32(len(f.Data)),
+	})
+	if err := sw.write(prefix); err != nil {
+		return err
+	}
+	return sw.write(f.Data)
+}
+
+// Close writes the frame index and footer. It does not close the underlying writer.
+func (sw *SnapshotWriter) Close() error {
+	if sw.closed {
+		return sw.err
+	}
+	sw.closed = true
+
+	indexOffset := sw.offset
+	index := make([]byte, 0, 12+len(sw.index)*snapshotIndexSize+8)
+	index = binary.LittleEndian.AppendUint32(index, snapshotIndexMark)
+	index = binary.LittleEndian.AppendUint64(index, uint64(len(sw.index)))
+	for _, e := range sw.index {
+		index = binary.LittleEndian.AppendUint64(index, e.offset)
+		index = binary.LittleEndian.AppendUint64(index, e.sequence)
+		index = binary.LittleEndian.AppendUint64(index, uint64(e.timestamp))
+		index = binary.LittleEndian.AppendUint32(index, e.size)
+	}
+	index = binary.LittleEndian.AppendUint64(index, indexOffset)
+	if err := sw.write(index); err != nil {
+		return err
+	}
+
+	footer := binary.LittleEndian.AppendUint32(nil, sw.crc.Sum32())
+	footer = append(footer, snapshotMagic...)
+	return sw.write(footer)
+}
+
+// write writes b, updating the offset and checksum.
+func (sw *SnapshotWriter) write(b []byte) error {
+	if sw.err != nil {
+		return sw.err
+	}
+	n, err := sw.w.Write(b)
+	sw.crc.Write(b[:n])
+	sw.offset += uint64(n)
+	sw.err = err
+	return err
+}
+
+// WriteTo writes the snapshot to w in the binary snapshot file format.
+// It implements io.WriterTo.
+func (s *Snapshot) WriteTo(w io.Writer) (int64, error) {
+	sw, err := NewSnapshotWriter(w, s.ID, s.Timestamp)
+	if err != nil {
+		return 0, err
+	}
+	for _, f := range s.Frames {
+		if err := sw.WriteFrame(f); err != nil {
+			return int64(sw.offset), err
+		}
+	}
+	err = sw.Close()
+	return int64(sw.offset), err
+}
+
+// SnapshotReader reads a snapshot file one frame at a time, verifying each
+// record and, at the end, the index and file checksum.
+type SnapshotReader struct {
+	r       *bufio.Reader
+	crc     hash.Hash32
+	offset  uint64
+	id      string
+	created time.Time
+	read    []snapshotIndex // frames read so far, checked against the index
+	done    bool
+}
+
+// NewSnapshotReader reads the header of a snapshot file from r.
+func NewSnapshotReader(r io.Reader) (*SnapshotReader, error) {
+	sr := SnapshotReader{r: bufio.NewReader(r), crc: crc32.NewIEEE()}
+
+	header := make([]byte, 8)
+	if err := sr.readFull(header); err != nil {
+		return nil, err
+	}
+	if string(header[:4]) != snapshotMagic {
+		return nil, fmt.Errorf("%w: not a snapshot file", ErrCorruptSnapshot)
+	}
+	if header[4] != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", header[4])
+	}
+
+	size, err := sr.readUvarint()
+	if err != nil {
+		return nil, err
+	}
+	if size > maxSnapshotRecord {
+		return nil, fmt.Errorf("%w: snapshot ID too long", ErrCorruptSnapshot)
+	}
+	id := make([]byte, size)
+	if err := sr.readFull(id); err != nil {
+		return nil, err
+	}
+	created := make([]byte, 8)
+	if err := sr.readFull(created); err != nil {
+		return nil, err
+	}
+
+	sr.id = string(id)
+	sr.created = time.Unix(0, int64(binary.LittleEndian.Uint64(created))).UTC()
+	return &sr, nil
+}
+
+// ID returns the ID of the snapshot.
+func (sr *SnapshotReader) ID() string {
+	return sr.id
+}
+
+// Timestamp returns when the snapshot was created.
+func (sr *SnapshotReader) Timestamp() time.Time {
+	return sr.created
+}
+
+// Next returns the next frame. After the last frame it verifies the index
+// and checksum and returns io.EOF, or ErrCorruptSnapshot if they do not match.
+func (sr *SnapshotReader) Next() (Frame, error) {
+	if sr.done {
+		return Frame{}, io.EOF
+	}
+
+	offset := sr.offset
+	header := make([]byte, recordHeaderSize)
+	if err := sr.readFull(header[:4]); err != nil {
+		return Frame{}, err
+	}
+	size := binary.LittleEndian.Uint32(header)
+	if size == snapshotIndexMark {
+		if err := sr.readTrailer(offset); err != nil {
+			return Frame{}, err
+		}
+		sr.done = true
+		return Frame{}, io.EOF
+	}
+
+	if err := sr.readFull(header[4:]); err != nil {
+		return Frame{}, err
+	}
+	if size > maxSnapshotRecord {
+		return Frame{}, fmt.Errorf("%w: frame record too large", ErrCorruptSnapshot)
+	}
+	body := make([]byte, size)
+	if err := sr.readFull(body); err != nil {
+		return Frame{}, err
+	}
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(header[4:]) {
+		return Frame{}, fmt.Errorf("%w: frame checksum mismatch", ErrCorruptSnapshot)
+	}
+
+	e, dataStart, err := decodeRecord(body)
+	if err != nil {
+		return Frame{}, fmt.Errorf("%w: %w", ErrCorruptSnapshot, err)
+	}
+	f := e.frame()
+	f.Data = body[dataStart:len(body):len(body)]
+
+	sr.read = append(sr.read, snapshotIndex{
+		offset:    offset,
+		sequence:  f.Sequence,
+		timestamp: f.Timestamp.UnixNano(),
+		size:      uint32(len(f.Data)),
+	})
+	return f, nil
+}
+
+// readTrailer reads the frame index and footer that start at indexOffset
+// and checks them against the frames read.
+func (sr *SnapshotReader) readTrailer(indexOffset uint64) error {
+	buf := make([]byte, 8)
+	if err := sr.readFull(buf); err != nil {
+		return err
+	}
+	count := binary.LittleEndian.Uint64(buf)
+	if count != uint64(len(sr.read)) {
+		return fmt.Errorf("%w: index lists %d frames, read %d", ErrCorruptSnapshot, count, len(sr.read))
+	}
+
+	entry := make([]byte, snapshotIndexSize)
+	for _, want := range sr.read {
+		if err := sr.readFull(entry); err != nil {
+			return err
+		}
+		got := snapshotIndex{
+			offset:    binary.LittleEndian.Uint64(entry),
+			sequence:  binary.LittleEndian.Uint64(entry[8:]),
+			timestamp: int64(binary.LittleEndian.Uint64(entry[16:])),
+			size:      binary.LittleEndian.Uint32(entry[24:]),
+		}
+		if got != want {
+			return fmt.Errorf("%w: index does not match frame at offset %d", ErrCorruptSnapshot, want.offset)
+		}
+	}
+
+	if err := sr.readFull(buf); err != nil {
+		return err
+	}
+	if binary.LittleEndian.Uint64(buf) != indexOffset {
+		return fmt.Errorf("%w: wrong index offset", ErrCorruptSnapshot)
+	}
+
+	sum := sr.crc.Sum32()
+	footer := make([]byte, snapshotFooterSize-8)
+	if err := sr.readFull(footer); err != nil {
+		return err
+	}
+	if binary.LittleEndian.Uint32(footer) != sum {
+		return fmt.Errorf("%w: file checksum mismatch", ErrCorruptSnapshot)
+	}
+	if string(footer[4:]) != snapshotMagic {
+		return fmt.Errorf("%w: missing footer", ErrCorruptSnapshot)
+	}
+	return nil
+}
+
+// readFull reads exactly len(b) bytes, updating the offset and checksum.
+// A short read is reported as a truncated file.
+func (sr *SnapshotReader) readFull(b []byte) error {
+	n, err := io.ReadFull(sr.r, b)
+	sr.crc.Write(b[:n])
+	sr.offset += uint64(n)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: unexpected end of file", ErrCorruptSnapshot)
+	}
+	return err
+}
+
+// readUvarint reads a uvarint, updating the offset and checksum.
+func (sr *SnapshotReader) readUvarint() (uint64, error) {
+	var buf [binary.MaxVarintLen64]byte
+	for i := range buf {
+		if err := sr.readFull(buf[i : i+1]); err != nil {
+			return 0, err
+		}
+		if buf[i] < 0x80 {
+			v, n := binary.Uvarint(buf[:i+1])
+			if n <= 0 {
+				break
+			}
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: invalid length", ErrCorruptSnapshot)
+}
+
+// ReadSnapshot reads a whole snapshot file written by Snapshot.WriteTo or SnapshotWriter.
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	sr, err := NewSnapshotReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := Snapshot{
+		ID:        sr.ID(),
+		Frames:    []Frame{},
+		Timestamp: sr.Timestamp(),
+	}
+	for {
+		f, err := sr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		snapshot.Frames = append(snapshot.Frames, f)
+	}
+
+	if n := len(snapshot.Frames); n > 0 {
+		snapshot.StartTime = snapshot.Frames[0].Timestamp
+		snapshot.EndTime = snapshot.Frames[n-1].Timestamp
+	}
+	return &snapshot, nil
+}
@@ -0,0 +1,154 @@
+package tidstrom
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// filePayloads covers a frame spanning several buffered reads, an empty
+// frame and a short one.
+var filePayloads = [][]byte{bytes.Repeat([]byte{0xff, 0x00}, 1000), {}, []byte("last")}
+
+// assertSnapshotsEqual compares snapshots field by field, with times compared by instant.
+func assertSnapshotsEqual(t *testing.T, expected, actual *Snapshot) {
+	t.Helper()
+
+	assert.Equal(t, expected.ID, actual.ID)
+	assert.True(t, expected.StartTime.Equal(actual.StartTime))
+	assert.True(t, expected.EndTime.Equal(actual.EndTime))
+	assert.True(t, expected.Timestamp.Equal(actual.Timestamp))
+
+	require.Len(t, actual.Frames, len(expected.Frames))
+	for i, want := range expected.Frames {
+		got := actual.Frames[i]
+		assert.Equal(t, want.ID, got.ID)
+		assert.Equal(t, want.Sequence, got.Sequence)
+		assert.True(t, want.Timestamp.Equal(got.Timestamp))
+		assert.Equal(t, want.Metadata, got.Metadata)
+		assert.Equal(t, want.Keyframe, got.Keyframe)
+		assert.Equal(t, string(want.Data), string(got.Data))
+	}
+}
+
+func TestSnapshotFileRoundTrip(t *testing.T) {
+	snapshot := testSnapshot(time.Second, filePayloads...)
+
+	var buf bytes.Buffer
+	n, err := snapshot.WriteTo(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, int64(buf.Len()), n)
+
+	encoded, err := json.Marshal(snapshot)
+	require.NoError(t, err)
+	assert.Less(t, buf.Len(), len(encoded)*3/4, "binary encoding should not inflate frame data")
+
+	decoded, err := ReadSnapshot(&buf)
+	require.NoError(t, err)
+	assertSnapshotsEqual(t, snapshot, decoded)
+}
+
+func TestSnapshotFileStreaming(t *testing.T) {
+	snapshot := testSnapshot(time.Second, filePayloads...)
+
+	var buf bytes.Buffer
+	sw, err := NewSnapshotWriter(&buf, snapshot.ID, snapshot.Timestamp)
+	require.NoError(t, err)
+	for _, f := range snapshot.Frames {
+		require.NoError(t, sw.WriteFrame(f))
+	}
+	// too large for a reader to accept; the pages are never touched
+	assert.Error(t, sw.WriteFrame(Frame{Data: make([]byte, maxSnapshotRecord)}))
+	require.NoError(t, sw.Close())
+	assert.Error(t, sw.WriteFrame(Frame{}), "writing after Close should fail")
+
+	sr, err := NewSnapshotReader(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, snapshot.ID, sr.ID())
+	assert.True(t, snapshot.Timestamp.Equal(sr.Timestamp()))
+
+	for _, want := range snapshot.Frames {
+		got, err := sr.Next()
+		require.NoError(t, err)
+		assert.Equal(t, want.Sequence, got.Sequence)
+		assert.Equal(t, string(want.Data), string(got.Data))
+	}
+	_, err = sr.Next()
+	assert.ErrorIs(t, err, io.EOF)
+	_, err = sr.Next()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestSnapshotFileEmpty(t *testing.T) {
+	snapshot := &Snapshot{ID: "empty", Frames: []Frame{}, Timestamp: time.Unix(0, 0).UTC()}
+
+	var buf bytes.Buffer
+	_, err := snapshot.WriteTo(&buf)
+	require.NoError(t, err)
+
+	decoded, err := ReadSnapshot(&buf)
+	require.NoError(t, err)
+	assertSnapshotsEqual(t, snapshot, decoded)
+}
+
+func TestSnapshotFileCorruption(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := testSnapshot(time.Second, filePayloads...).WriteTo(&buf)
+	require.NoError(t, err)
+	encoded := buf.Bytes()
+
+	testCases := []struct {
+		name    string
+		corrupt func(b []byte) []byte
+	}{
+		{
+			name:    "Not a snapshot",
+			corrupt: func(b []byte) []byte { return []byte("definitely not a snapshot") },
+		},
+		{
+			name:    "Truncated frames",
+			corrupt: func(b []byte) []byte { return b[:len(b)/2] },
+		},
+		{
+			name:    "Truncated footer",
+			corrupt: func(b []byte) []byte { return b[:len(b)-2] },
+		},
+		{
+			name: "Frame data",
+			corrupt: func(b []byte) []byte {
+				b[100] ^= 0x01
+				return b
+			},
+		},
+		{
+			name: "Index",
+			corrupt: func(b []byte) []byte {
+				b[len(b)-snapshotFooterSize-4] ^= 0x01
+				return b
+			},
+		},
+		{
+			name: "File checksum",
+			corrupt: func(b []byte) []byte {
+				b[len(b)-6] ^= 0x01
+				return b
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			corrupted := tc.corrupt(bytes.Clone(encoded))
+
+			_, err := ReadSnapshot(bytes.NewReader(corrupted))
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, ErrCorruptSnapshot), "unexpected error: %v", err)
+		})
+	}
+}
@@ -0,0 +1,415 @@
+package tidstrom
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultSegmentSize is the default size at which a segment file is sealed.
+	defaultSegmentSize = 64 << 20
+
+	// defaultSegmentDuration is the default time span covered by a segment file.
+	defaultSegmentDuration = time.Minute
+
+	// segmentExt is the file extension of segment files.
+	segmentExt = ".seg"
+)
+
+// ErrStoreClosed is returned when writing to or reading from a closed SegmentStore.
+var ErrStoreClosed = errors.New("segment store is closed")
+
+// errFrameDeleted reports a read of a frame whose segment has been deleted.
+var errFrameDeleted = errors.New("frame was deleted from the segment store")
+
+// SpillMode selects which frames a StreamBuffer writes to its SegmentStore.
+type SpillMode int
+
+const (
+	// SpillEvicted writes frames evicted from memory by the capacity or byte
+	// budget while they are still within the window.
+	SpillEvicted SpillMode = iota
+	// SpillAll writes every stored frame as it arrives.
+	SpillAll
+)
+
+// SegmentStore keeps frames in append-only segment files in a directory.
+// Each segment covers a span of time, and segments are deleted once all of
+// their frames have left the window. It is safe for concurrent use.
+type SegmentStore struct {
+	dir         string
+	maxSize     int64         // size at which a segment is sealed
+	maxDuration time.Duration // time span at which a segment is sealed
+	syncWrites  bool          // sync each write to stable storage
+
+	mu       sync.Mutex
+	segments []*segment // ordered by creation, the last one may be active
+	active   *segment   // segment being written, nil until the next append
+	closed   bool
+}
+
+// SegmentStoreOption configures a SegmentStore.
+type SegmentStoreOption func(*SegmentStore)
+
+// WithSegmentSize sets the size in bytes at which a segment file is sealed
+// and a new one started.
+func WithSegmentSize(n int64) SegmentStoreOption {
+	return func(s *SegmentStore) {
+		if n > 0 {
+			s.maxSize = n
+		}
+	}
+}
+
+// WithSegmentDuration sets the span of frame timestamps a segment file covers
+// before a new one is started. Shorter segments let expired frames be deleted sooner.
+func WithSegmentDuration(d time.Duration) SegmentStoreOption {
+	return func(s *SegmentStore) {
+		if d > 0 {
+			s.maxDuration = d
+		}
+	}
+}
+
+// WithSyncWrites makes every write wait until the frame is on stable storage,
+// so that frames survive an operating system crash or power loss, at the
+// cost of write throughput.
+func WithSyncWrites() SegmentStoreOption {
+	return func(s *SegmentStore) {
+		s.syncWrites = true
+	}
+}
+
+// OpenSegmentStore opens the segment store in dir, creating the directory if
+// needed and indexing any segments already in it. New frames are always
+// written to a new segment.
+func OpenSegmentStore(dir string, opts ...SegmentStoreOption) (*SegmentStore, error) {
+	s := SegmentStore{
+		dir:         dir,
+		maxSize:     defaultSegmentSize,
+		maxDuration: defaultSegmentDuration,
+	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(paths)
+
+	for _, path := range paths {
+		seg, err := openSegment(path)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.segments = append(s.segments, seg)
+	}
+	return &s, nil
+}
+
+// Sync commits the segment being written to stable storage.
+func (s *SegmentStore) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrStoreClosed
+	}
+	if s.active == nil {
+		return nil
+	}
+	return s.active.file.Sync()
+}
+
+// Close closes the segment files. The files are kept for the next OpenSegmentStore.
+func (s *SegmentStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	var errs []error
+	for _, seg := range s.segments {
+		errs = append(errs, seg.file.Close())
+	}
+	s.segments = nil
+	s.active = nil
+	return errors.Join(errs...)
+}
+
+// append writes a frame, starting a new segment when the active one is full
+// or spans too much time.
+func (s *SegmentStore) append(f *Frame) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrStoreClosed
+	}
+
+	if a := s.active; a == nil || a.size >= s.maxSize || f.Timestamp.Sub(a.start) >= s.maxDuration {
+		name := fmt.Sprintf("%020d-%020d%s", f.Timestamp.UnixNano(), f.Sequence, segmentExt)
+		seg, err := createSegment(filepath.Join(s.dir, name))
+		if err != nil {
+			return err
+		}
+		s.segments = append(s.segments, seg)
+		s.active = seg
+	}
+	if err := s.active.append(f); err != nil {
+		return err
+	}
+	if s.syncWrites {
+		return s.active.file.Sync()
+	}
+	return nil
+}
+
+// maxSequence returns the highest stored frame sequence and whether there is one.
+func (s *SegmentStore) maxSequence() (uint64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var (
+		highest uint64
+		found   bool
+	)
+	for _, seg := range s.segments {
+		for _, e := range seg.entries {
+			if !found || e.sequence > highest {
+				highest, found = e.sequence, true
+			}
+		}
+	}
+	return highest, found
+}
+
+// entries returns the entries of frames with timestamps between from and to,
+// inclusive, ordered by timestamp and then sequence. A zero to leaves the
+// range open.
+func (s *SegmentStore) entries(from, to time.Time) []segmentEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var entries []segmentEntry
+	for _, seg := range s.segments {
+		if seg.end.Before(from) || !to.IsZero() && seg.start.After(to) {
+			continue
+		}
+		for _, e := range seg.entries {
+			if e.timestamp.Before(from) || !to.IsZero() && e.timestamp.After(to) {
+				continue
+			}
+			entries = append(entries, e)
+		}
+	}
+	slices.SortFunc(entries, func(a, b segmentEntry) int {
+		if c := a.timestamp.Compare(b.timestamp); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.sequence, b.sequence)
+	})
+	return entries
+}
+
+// keyframeAtOrBefore returns the timestamp of the latest keyframe between
+// floor and t, inclusive, and whether there is one.
+func (s *SegmentStore) keyframeAtOrBefore(floor, t time.Time) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var (
+		latest time.Time
+		found  bool
+	)
+	for _, seg := range s.segments {
+		if seg.end.Before(floor) || seg.start.After(t) {
+			continue
+		}
+		for _, e := range seg.entries {
+			if !e.keyframe || e.timestamp.Before(floor) || e.timestamp.After(t) {
+				continue
+			}
+			if !found || e.timestamp.After(latest) {
+				latest, found = e.timestamp, true
+			}
+		}
+	}
+	return latest, found
+}
+
+// read appends the data of the frame at e to dst.
+func (s *SegmentStore) read(dst []byte, e *segmentEntry) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return dst, ErrStoreClosed
+	}
+	if !slices.Contains(s.segments, e.seg) {
+		return dst, fmt.Errorf("frame %d: %w", e.sequence, errFrameDeleted)
+	}
+	return e.seg.read(dst, e)
+}
+
+// deleteBefore removes the segments whose frames are all older than cutoff.
+func (s *SegmentStore) deleteBefore(cutoff time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	s.segments = slices.DeleteFunc(s.segments, func(seg *segment) bool {
+		if len(seg.entries) == 0 || !seg.end.Before(cutoff) {
+			return false
+		}
+		if seg == s.active {
+			s.active = nil
+		}
+		errs = append(errs, seg.file.Close(), os.Remove(seg.path))
+		return true
+	})
+	return errors.Join(errs...)
+}
+
+// queueSpill holds a reference to a frame until flushSpill writes it to the
+// segment store. Typed frames carry no data and are not spilled.
+// Must be called with mu held.
+func (sb *StreamBuffer) queueSpill(f *Frame) {
+	if f.value != nil || f.ref == nil {
+		return
+	}
+	f.ref.retain()
+	sb.spillQueue = append(sb.spillQueue, *f)
+}
+
+// flushSpill writes the queued frames to the segment store. It runs on the
+// processing loop after the buffer is unlocked, so disk writes do not block readers.
+func (sb *StreamBuffer) flushSpill() {
+	for i := range sb.spillQueue {
+		f := &sb.spillQueue[i]
+		if err := sb.store.append(f); err != nil {
+			sb.spillErrors.Add(1)
+		} else {
+			sb.framesSpilled.Add(1)
+		}
+		f.ref.release()
+		*f = Frame{}
+	}
+	sb.spillQueue = sb.spillQueue[:0]
+}
+
+// withSpilled returns the buffered frames merged with the spilled frames that
+// q could select, ordered by timestamp, along with the entries of the spilled
+// ones, which have no data. Must be called with mu held.
+func (sb *StreamBuffer) withSpilled(q snapshotQuery) (frameSlice, map[uint64]segmentEntry) {
+	cutoff := sb.streamTime().Add(-sb.window)
+	from := q.from
+	if from.Before(cutoff) {
+		from = cutoff
+	}
+	if q.keyframe {
+		if t, ok := sb.store.keyframeAtOrBefore(cutoff, from); ok {
+			from = t
+		}
+	}
+
+	buffered := make(map[uint64]struct{}, sb.count)
+	for i := range sb.count {
+		buffered[sb.frameAt(i).Sequence] = struct{}{}
+	}
+
+	entries := sb.store.entries(from, q.to)
+	merged := make(frameSlice, 0, len(entries)+sb.count)
+	spilled := make(map[uint64]segmentEntry, len(entries))
+	for _, e := range entries {
+		if _, ok := buffered[e.sequence]; ok {
+			continue // SpillAll keeps buffered frames on disk too
+		}
+
+		merged = append(merged, e.frame())
+		spilled[e.sequence] = e
+	}
+	for i := range sb.count {
+		merged = append(merged, *sb.frameAt(i))
+	}
+
+	slices.SortStableFunc(merged, func(a, b Frame) int {
+		if c := a.Timestamp.Compare(b.Timestamp); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Sequence, b.Sequence)
+	})
+	return merged, spilled
+}
+
+// spilledFrame is a snapshot frame whose data is still in the segment store.
+type spilledFrame struct {
+	index int // position in the snapshot
+	entry segmentEntry
+}
+
+// readSpilled reads the data of the snapshot's spilled frames, ordered by
+// position. It runs on the requesting goroutine, so disk reads stall neither
+// the processing loop nor the buffer lock. Predicates in q are applied to each
+// frame as it is read, and then the limit. Frames whose segment was deleted
+// in the meantime have left the window and are dropped.
+func (sb *StreamBuffer) readSpilled(s *Snapshot, spilled []spilledFrame, q snapshotQuery) error {
+	frames := s.Frames
+	kept := frames[:0]
+	for i := range frames {
+		f := frames[i]
+		if len(spilled) > 0 && spilled[0].index == i {
+			data, err := sb.store.read(sb.bufferPool.get(), &spilled[0].entry)
+			spilled = spilled[1:]
+			if errors.Is(err, errFrameDeleted) {
+				sb.bufferPool.put(data)
+				continue
+			}
+			if err != nil {
+				sb.bufferPool.put(data)
+				s.Frames = append(kept, frames[i+1:]...)
+				s.Release()
+				return err
+			}
+
+			// the snapshot is the only holder, in either mode
+			f.Data = data
+			f.ref = newFrameRef(data, sb.bufferPool)
+			if !q.match(&f) {
+				s.releaseFrame(&f)
+				continue
+			}
+		}
+		kept = append(kept, f)
+	}
+
+	if q.last > 0 && len(kept) > q.last {
+		for i := range len(kept) - q.last {
+			s.releaseFrame(&kept[i])
+		}
+		kept = kept[len(kept)-q.last:]
+	}
+
+	s.Frames = kept
+	s.StartTime, s.EndTime = time.Time{}, time.Time{}
+	if len(kept) > 0 {
+		s.StartTime = kept[0].Timestamp
+		s.EndTime = kept[len(kept)-1].Timestamp
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+package tidstrom
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alesr/tidstrom/tidstromtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamBufferSpillEvicted(t *testing.T) {
+	store, err := OpenSegmentStore(t.TempDir(), WithSegmentDuration(2*time.Second))
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+
+	sb, _, base := newTestBuffer(t, WithSpill(store, SpillEvicted), WithCapacity(4))
+	ctx := context.Background()
+
+	assert.Equal(t, uint64(6), sb.GetMetrics().FramesSpilled)
+	assert.Equal(t, 4, sb.GetMetrics().FrameCount)
+
+	snapshot, err := sb.GetSnapshot(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Frame 0", "Frame 1", "Frame 2", "Frame 3", "Frame 4",
+		"Frame 5", "Frame 6", "Frame 7", "Frame 8", "Frame 9"}, frameData(snapshot.Frames))
+	for i, frame := range snapshot.Frames {
+		assert.Equal(t, uint64(i), frame.Sequence)
+		assert.True(t, base.Add(time.Duration(i)*time.Second).Equal(frame.Timestamp))
+		assert.NotEmpty(t, frame.ID)
+	}
+	snapshot.Release()
+
+	testCases := []struct {
+		name     string
+		get      func() (*Snapshot, error)
+		expected []string
+	}{
+		{
+			name: "Range across tiers",
+			get: func() (*Snapshot, error) {
+				return sb.GetRange(ctx, base.Add(4*time.Second), base.Add(7*time.Second))
+			},
+			expected: []string{"Frame 4", "Frame 5", "Frame 6", "Frame 7"},
+		},
+		{
+			name:     "Last",
+			get:      func() (*Snapshot, error) { return sb.GetLast(ctx, 7) },
+			expected: []string{"Frame 3", "Frame 4", "Frame 5", "Frame 6", "Frame 7", "Frame 8", "Frame 9"},
+		},
+		{
+			name: "Predicate on spilled data",
+			get: func() (*Snapshot, error) {
+				return sb.GetSnapshot(ctx, Where(func(f *Frame) bool {
+					return string(f.Data) == "Frame 1" || string(f.Data) == "Frame 8"
+				}))
+			},
+			expected: []string{"Frame 1", "Frame 8"},
+		},
+		{
+			name: "Predicate and limit across tiers",
+			get: func() (*Snapshot, error) {
+				return sb.GetSnapshot(ctx, Limit(3), Where(func(f *Frame) bool {
+					return (f.Data[len(f.Data)-1]-'0')%2 == 0
+				}))
+			},
+			expected: []string{"Frame 4", "Frame 6", "Frame 8"},
+		},
+		{
+			name: "Predicate and limit with spilled frames filtered out",
+			get: func() (*Snapshot, error) {
+				return sb.GetSnapshot(ctx, SequenceRange(6, 9), Limit(1), Where(func(f *Frame) bool {
+					return (f.Data[len(f.Data)-1]-'0')%2 == 0
+				}))
+			},
+			expected: []string{"Frame 8"},
+		},
+		{
+			name: "From spilled keyframe",
+			get: func() (*Snapshot, error) {
+				return sb.GetRange(ctx, base.Add(4*time.Second), base.Add(6*time.Second), FromKeyframe())
+			},
+			expected: []string{"Frame 2", "Frame 3", "Frame 4", "Frame 5", "Frame 6"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			snapshot, err := tc.get()
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, frameData(snapshot.Frames))
+			snapshot.Release()
+		})
+	}
+
+	since, gap, err := sb.GetSince(ctx, 3)
+	require.NoError(t, err)
+	assert.False(t, gap, "spilled frames should not count as a gap")
+	assert.Len(t, since.Frames, 7)
+}
+
+func TestStreamBufferSpillAll(t *testing.T) {
+	store, err := OpenSegmentStore(t.TempDir(), WithSegmentDuration(2*time.Second))
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+
+	sb, clock, base := newTestBuffer(t, WithSpill(store, SpillAll), WithWindow(10*time.Second))
+	ctx := context.Background()
+
+	assert.Equal(t, uint64(10), sb.GetMetrics().FramesSpilled)
+
+	snapshot, err := sb.GetSnapshot(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Frame 0", "Frame 1", "Frame 2", "Frame 3", "Frame 4",
+		"Frame 5", "Frame 6", "Frame 7", "Frame 8", "Frame 9"}, frameData(snapshot.Frames),
+		"frames in memory and on disk should not be duplicated")
+
+	segments, err := filepath.Glob(filepath.Join(store.dir, "*.seg"))
+	require.NoError(t, err)
+	assert.Len(t, segments, 5)
+
+	// six seconds after frame 9 arrived, frames 0-4 have left the window
+	clock.Set(base.Add(15 * time.Second))
+
+	snapshot, err = sb.GetSnapshot(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Frame 5", "Frame 6", "Frame 7", "Frame 8", "Frame 9"}, frameData(snapshot.Frames))
+
+	segments, err = filepath.Glob(filepath.Join(store.dir, "*.seg"))
+	require.NoError(t, err)
+	assert.Len(t, segments, 3, "segments whose frames have all expired should be deleted")
+	assert.Zero(t, sb.GetMetrics().SpillErrors)
+}
+
+func TestSegmentStoreReopen(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	store, err := OpenSegmentStore(dir)
+	require.NoError(t, err)
+	for i := range 3 {
+		require.NoError(t, store.append(&Frame{
+			Data:      fmt.Appendf(nil, "Frame %d", i),
+			Timestamp: base.Add(time.Duration(i) * time.Second),
+			Sequence:  uint64(i),
+		}))
+	}
+	require.NoError(t, store.Sync())
+	require.NoError(t, store.Close())
+	assert.ErrorIs(t, store.append(&Frame{}), ErrStoreClosed)
+
+	reopened, err := OpenSegmentStore(dir)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	entries := reopened.entries(base.Add(time.Second), time.Time{})
+	require.Len(t, entries, 2)
+
+	data, err := reopened.read(nil, &entries[1])
+	require.NoError(t, err)
+	assert.Equal(t, "Frame 2", string(data))
+}
+
+func TestStreamBufferSpillZeroCopyRelease(t *testing.T) {
+	store, err := OpenSegmentStore(t.TempDir(), WithSegmentDuration(2*time.Second))
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+
+	sb, _, _ := newTestBuffer(t, WithSpill(store, SpillEvicted), WithCapacity(4), WithZeroCopySnapshots())
+
+	snapshot, err := sb.GetSnapshot(context.Background())
+	require.NoError(t, err)
+	require.Len(t, snapshot.Frames, 10)
+
+	var refs []*frameRef
+	for _, frame := range snapshot.Frames {
+		require.NotNil(t, frame.ref, "every frame should be released through a reference")
+		refs = append(refs, frame.ref)
+	}
+	assert.Equal(t, int32(1), refs[0].refs.Load(), "spilled frames should be held by the snapshot alone")
+
+	snapshot.Release()
+	for i, ref := range refs[:6] {
+		assert.Zero(t, ref.refs.Load(), "spilled frame %d should be recycled", i)
+	}
+	for i, ref := range refs[6:] {
+		assert.Equal(t, int32(1), ref.refs.Load(), "buffered frame %d should stay held by the buffer", i+6)
+	}
+}
+
+func TestStreamBufferSpillReopenedStore(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	dir := t.TempDir()
+
+	// each run opens the store and spills four frames
+	run := func(name string, start time.Time) (*StreamBuffer, *SegmentStore) {
+		store, err := OpenSegmentStore(dir)
+		require.NoError(t, err)
+		sb := NewStreamBuffer(
+			WithWindow(time.Hour),
+			WithCapacity(2),
+			WithClock(tidstromtest.NewClock(start)),
+			WithSpill(store, SpillAll),
+		)
+		sb.Start()
+		t.Cleanup(func() {
+			sb.Stop()
+			store.Close()
+		})
+
+		for i := range 4 {
+			require.NoError(t, sb.PushFrame(context.Background(), Frame{
+				Data:      fmt.Appendf(nil, "%s%d", name, i),
+				Timestamp: start.Add(time.Duration(i) * time.Second),
+			}))
+		}
+		require.Eventually(t, func() bool {
+			return sb.GetMetrics().FramesSpilled == 4
+		}, time.Second, time.Millisecond)
+		return sb, store
+	}
+
+	first, store := run("a", base)
+	first.Stop()
+	require.NoError(t, store.Close())
+	second, _ := run("b", base.Add(10*time.Second))
+
+	snapshot, err := second.GetSnapshot(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a0", "a1", "a2", "a3", "b0", "b1", "b2", "b3"}, frameData(snapshot.Frames),
+		"frames from the earlier run should keep their own data")
+	for i, frame := range snapshot.Frames {
+		assert.Equal(t, uint64(i), frame.Sequence, "sequences should continue after the earlier run")
+	}
+}
+
+func TestStreamBufferSpillReadsOffLoop(t *testing.T) {
+	store, err := OpenSegmentStore(t.TempDir(), WithSegmentDuration(2*time.Second))
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+
+	sb, _, base := newTestBuffer(t, WithSpill(store, SpillEvicted), WithCapacity(4))
+
+	// a predicate on a spilled frame blocks the snapshot until released
+	reading, release := make(chan struct{}), make(chan struct{})
+	type result struct {
+		snapshot *Snapshot
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		snapshot, err := sb.GetSnapshot(context.Background(), Where(func(f *Frame) bool {
+			if string(f.Data) == "Frame 1" {
+				close(reading)
+				<-release
+			}
+			return true
+		}))
+		done <- result{snapshot, err}
+	}()
+	<-reading
+
+	// the processing loop keeps storing frames meanwhile
+	pushGOPs(t, sb, base, 10, 1)
+	assert.Equal(t, uint64(11), sb.GetMetrics().FramesProcessed)
+
+	close(release)
+	r := <-done
+	require.NoError(t, r.err)
+	assert.Len(t, r.snapshot.Frames, 10)
+}
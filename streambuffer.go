@@ -2,6 +2,7 @@
 package tidstrom
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"errors"
@@ -22,16 +23,40 @@ const (
 
 	// defaultBufferCapacity is the default frame capacity.
 	defaultBufferCapacity = 300
+
+	// defaultSampleEvery is the default sampling rate under BackpressureSample.
+	defaultSampleEvery = 2
+
+	// defaultTrimInterval is the default minimum delay between background trims.
+	defaultTrimInterval = 100 * time.Millisecond
 )
 
 // Frame represents a single data entry with timing and sequence metadata.
 type Frame struct {
 	ID        string    `json:"id"`
-	Data      []byte    `json:"data"`      // actual frame data
-	Timestamp time.Time `json:"timestamp"` // capture time
-	Sequence  uint64    `json:"sequence"`  // unique monotonic ID
+	Data      []byte    `json:"data"`               // actual frame data
+	Timestamp time.Time `json:"timestamp"`          // capture time
+	Sequence  uint64    `json:"sequence"`           // unique monotonic ID
+	Metadata  Metadata  `json:"metadata,omitempty"` // optional frame attributes
+	Keyframe  bool      `json:"keyframe,omitempty"` // starts a group of pictures
+
+	ref   *frameRef // shared data buffer, set for buffered and zero-copy frames
+	value any       // payload of TypedBuffer frames, which carry no data
 }
 
+// LatenessPolicy controls how frames arriving later than the reorder window are handled.
+type LatenessPolicy int
+
+const (
+	// LatenessAccept inserts late frames into their timestamp position.
+	LatenessAccept LatenessPolicy = iota
+	// LatenessDrop discards late frames.
+	LatenessDrop
+	// LatenessClamp restamps late frames with the stream's current time,
+	// the newest frame timestamp, and appends them.
+	LatenessClamp
+)
+
 // Snapshot contains a point-in-time copy of frames within the buffer.
 type Snapshot struct {
 	ID        string    `json:"id"`
@@ -39,12 +64,38 @@ type Snapshot struct {
 	StartTime time.Time `json:"start_time"` // timestamp of oldest frame
 	EndTime   time.Time `json:"end_time"`   // timestamp of newest frame
 	Timestamp time.Time `json:"timestamp"`  // when snapshot was created
+
+	pool *bufferPool // source of copied frame data, nil if not pooled
+}
+
+// Release returns the snapshot's frame data to the StreamBuffer for reuse.
+// Zero-copy frames are recycled once every snapshot sharing them is released.
+// The frames must not be used after Release. Calling Release again has no
+// effect, and snapshots that are never released are reclaimed by the garbage
+// collector. Release is not safe for concurrent use.
+func (s *Snapshot) Release() {
+	for i := range s.Frames {
+		s.releaseFrame(&s.Frames[i])
+	}
 }
 
-// snapshotRequest bundles the context and result channel for a snapshot request.
+// releaseFrame returns the data of one of the snapshot's frames.
+func (s *Snapshot) releaseFrame(f *Frame) {
+	switch {
+	case f.ref != nil:
+		f.ref.release()
+		f.ref = nil
+	case s.pool != nil && f.Data != nil:
+		s.pool.put(f.Data)
+	}
+	f.Data = nil
+}
+
+// snapshotRequest bundles the context, query and result channel for a snapshot request.
 type snapshotRequest struct {
-	resultChan chan<- *Snapshot // where to send the result
-	ctx        context.Context  // for cancellation
+	resultChan chan<- snapshotResult // where to send the result
+	ctx        context.Context       // for cancellation
+	query      snapshotQuery         // frames to include
 }
 
 // StreamBuffer continuously processes incoming data frames, maintaining
@@ -52,16 +103,31 @@ type snapshotRequest struct {
 type StreamBuffer struct {
 	// configuration
 	window         time.Duration
+	trimInterval   time.Duration // minimum delay between background trims
 	capacity       int
 	bufferPool     *bufferPool
-	frameSize      int       // hint for expected frame size
-	maxRecycleSize int       // maximum size of buffers to recycle
-	entropy        io.Reader // ID generation
+	frameSize      int            // hint for expected frame size
+	maxFrameSize   int            // largest accepted frame, 0 for no limit
+	maxBytes       int            // byte budget for stored frames, 0 for no limit
+	maxRecycleSize int            // maximum size of buffers to recycle
+	entropy        io.Reader      // ID generation
+	clock          Clock          // time source
+	reorderWindow  time.Duration  // tolerated out-of-order delay
+	lateness       LatenessPolicy // handling of frames beyond reorderWindow
+	dropHandler    func(DropReason, []byte)
+	zeroCopy       bool               // snapshots share frame buffers instead of copying
+	backpressure   BackpressurePolicy // handling of pushes when input is full
+	sampleEvery    int                // frames kept under BackpressureSample
+	keyframes      bool               // evict whole groups of pictures
+	store          *SegmentStore      // spill tier, nil if memory-only
+	spillMode      SpillMode          // frames written to store
+	recoverFrames  bool               // restore the window from store on creation
 
 	// internal state
-	frames       []Frame     // circular buffer
+	frames       []Frame     // circular buffer ordered by timestamp
 	head         int         // next write position
 	count        int         // valid frame count
+	bytes        int         // capacity of stored frame data buffers
 	nextSeq      uint64      // sequence counter
 	running      atomic.Bool // running state
 	finalStopped atomic.Bool // permanent stop flag
@@ -69,19 +135,47 @@ type StreamBuffer struct {
 	// synchronization
 	mu         sync.RWMutex
 	shutdownMu sync.Mutex
+	subMu      sync.Mutex // guards subscribers
+
+	// subscriptions
+	subscribers     map[*subscriber]struct{}
+	subscriberCount atomic.Int32
+
+	// clip being collected, owned by processLoop
+	clip *clipState
+
+	// frames awaiting a write to store, owned by processLoop
+	spillQueue []Frame
 
 	// channels
-	input    chan []byte          // incoming frames
-	snapReq  chan snapshotRequest // snapshot requests
-	shutdown chan struct{}
+	input      chan []byte          // frames sent on Input
+	frameInput chan Frame           // frames sent on InputFrames
+	queue      chan Frame           // frames waiting to be processed
+	snapReq    chan snapshotRequest // snapshot requests
+	trigReq    chan triggerRequest  // clip triggers
+	shutdown   chan struct{}
 
 	// metrics
-	framesProcessed atomic.Uint64
-	framesDropped   atomic.Uint64
-	framesTrimmed   atomic.Uint64
-	snapshotsSent   atomic.Uint64
-	creationTime    time.Time
-	lastFrameTime   time.Time
+	framesProcessed     atomic.Uint64
+	framesDropped       atomic.Uint64
+	framesTrimmed       atomic.Uint64
+	framesLate          atomic.Uint64
+	framesEvicted       atomic.Uint64
+	pushesBlocked       atomic.Uint64
+	framesDroppedNewest atomic.Uint64
+	framesDroppedOldest atomic.Uint64
+	framesSampledOut    atomic.Uint64
+	sampleCount         atomic.Uint64
+	snapshotsSent       atomic.Uint64
+	subscriberDrops     atomic.Uint64
+	clipsSent           atomic.Uint64
+	triggersPending     atomic.Int64
+	framesSpilled       atomic.Uint64
+	framesRecovered     atomic.Uint64
+	spillErrors         atomic.Uint64
+	creationTime        time.Time
+	lastFrameTime       time.Time
+	lastFrameAt         time.Time // clock time when lastFrameTime was reached
 }
 
 // NewStreamBuffer creates a new StreamBuffer with the specified options.
@@ -90,27 +184,44 @@ func NewStreamBuffer(opts ...StreamBufferOption) *StreamBuffer {
 	entropy := ulid.Monotonic(rand.Reader, 0)
 	sb := StreamBuffer{
 		window:         defaultWindowDuration,
+		trimInterval:   defaultTrimInterval,
 		capacity:       defaultBufferCapacity,
 		frameSize:      1024 * 1024, // 1MB
 		maxRecycleSize: defaultMaxBufferSize,
 		nextSeq:        0,
-		creationTime:   time.Now(),
 		lastFrameTime:  time.Time{},
 		snapReq:        make(chan snapshotRequest, 10),
+		trigReq:        make(chan triggerRequest, 10),
 		shutdown:       make(chan struct{}),
 		entropy:        entropy,
+		clock:          systemClock{},
+		sampleEvery:    defaultSampleEvery,
 	}
 
 	for _, opt := range opts {
 		opt(&sb)
 	}
 
+	sb.creationTime = sb.clock.Now()
+
 	sb.frames = make([]Frame, sb.capacity)
 	sb.bufferPool = newBufferPool(sb.frameSize, withMaxBufferSize(sb.maxRecycleSize))
 
 	if sb.input == nil {
 		sb.input = make(chan []byte, 100)
 	}
+	sb.frameInput = make(chan Frame, cap(sb.input))
+	sb.queue = make(chan Frame, cap(sb.input))
+
+	if sb.store != nil {
+		// frames left in the store by an earlier run stay distinct from new ones
+		if seq, ok := sb.store.maxSequence(); ok {
+			sb.nextSeq = seq + 1
+		}
+		if sb.recoverFrames {
+			sb.recover()
+		}
+	}
 	return &sb
 }
 
@@ -124,7 +235,9 @@ func (sb *StreamBuffer) Start() {
 		if sb.shutdown == nil {
 			sb.shutdown = make(chan struct{})
 		}
+		shutdownCh := sb.shutdown
 		sb.shutdownMu.Unlock()
+		go sb.forwardInput(shutdownCh)
 		go sb.processLoop()
 	}
 }
@@ -143,22 +256,24 @@ func (sb *StreamBuffer) Stop() {
 
 		sb.mu.Lock()
 		for i := range sb.count {
-			idx := (sb.head - sb.count + i + sb.capacity) % sb.capacity
-			if sb.frames[idx].Data != nil {
-				sb.bufferPool.put(sb.frames[idx].Data)
-				sb.frames[idx].Data = nil
-			}
+			sb.recycle(sb.index(i))
 		}
 		sb.mu.Unlock()
+
+		sb.closeSubscribers()
 	}
 }
 
 // processLoop is the main event loop handling frames and snapshot requests.
+// It also expires frames on a timer so the window holds when no frames arrive.
 func (sb *StreamBuffer) processLoop() {
 	defer func() {
 		sb.running.Store(false)
 	}()
 
+	var trimC <-chan time.Time // nil while no trim is scheduled
+	var clipC <-chan time.Time // nil while no clip is collecting
+
 	for {
 		sb.shutdownMu.Lock()
 		shutdownCh := sb.shutdown
@@ -168,32 +283,53 @@ func (sb *StreamBuffer) processLoop() {
 			return
 		}
 
+		if trimC == nil {
+			if delay, ok := sb.nextTrimDelay(); ok {
+				trimC = sb.clock.After(delay)
+			}
+		}
+		if clipC == nil && sb.clip != nil {
+			// stream time advances with the clock, so the gap is also a clock delay
+			clipC = sb.clock.After(sb.clip.end.Sub(sb.now()))
+		}
+
 		select {
 		case <-shutdownCh:
 			return
 
-		case frame, ok := <-sb.input:
-			if !ok {
-				return
+		case frame := <-sb.queue:
+			sb.handleFrame(frame, shutdownCh)
+
+		case <-trimC:
+			trimC = nil
+			sb.expire()
+
+		case req := <-sb.trigReq:
+			sb.startClip(req)
+
+		case <-clipC:
+			clipC = nil
+			if sb.clip != nil && !sb.now().Before(sb.clip.end) {
+				sb.finishClip()
 			}
-			sb.processFrame(frame)
 
 		case req := <-sb.snapReq:
 			select {
 			case <-req.ctx.Done():
 				// context already canceled
 			default:
-				snapshot := sb.createSnapshot()
+				sb.expire()
+				result := sb.createSnapshot(req.query)
+				snapshot := result.snapshot
 				select {
-				case req.resultChan <- snapshot:
-					sb.snapshotsSent.Add(1)
+				case req.resultChan <- result:
+					if result.err == nil {
+						sb.snapshotsSent.Add(1)
+					}
 				case <-req.ctx.Done():
 					// free snapshot memory on cancellation
-					for i := range snapshot.Frames {
-						if snapshot.Frames[i].Data != nil {
-							sb.bufferPool.put(snapshot.Frames[i].Data)
-							snapshot.Frames[i].Data = nil
-						}
+					if snapshot != nil {
+						snapshot.Release()
 					}
 				}
 			}
@@ -201,128 +337,398 @@ func (sb *StreamBuffer) processLoop() {
 	}
 }
 
+// handleFrame stores a frame and hands a copy to subscribers and the clip being collected.
+func (sb *StreamBuffer) handleFrame(in Frame, shutdownCh <-chan struct{}) {
+	f, ok := sb.processFrame(in)
+	if sb.store != nil {
+		sb.flushSpill()
+	}
+	if !ok {
+		return
+	}
+	sb.publish(f, shutdownCh)
+	sb.collectClipFrame(f)
+}
+
 // processFrame adds a new frame to the buffer and trims old frames.
-func (sb *StreamBuffer) processFrame(data []byte) {
+// Frames without a timestamp are stamped with the current time. Frames older
+// than the newest one are inserted in timestamp order; those beyond the
+// reorder window are handled according to the lateness policy.
+// If there are subscribers or a clip is collecting, it returns a detached copy
+// of the stored frame for them.
+func (sb *StreamBuffer) processFrame(in Frame) (Frame, bool) {
 	sb.mu.Lock()
 	defer sb.mu.Unlock()
 
-	now := time.Now()
+	ts := in.Timestamp
+	if ts.IsZero() {
+		ts = sb.clock.Now()
+	}
 
-	if sb.count == sb.capacity {
-		// recycle memory from the frame we're about to overwrite
-		oldestIdx := sb.head % sb.capacity
-		if sb.frames[oldestIdx].Data != nil {
-			sb.bufferPool.put(sb.frames[oldestIdx].Data)
-			sb.frames[oldestIdx].Data = nil
+	if sb.count > 0 {
+		newest := sb.frames[sb.index(sb.count-1)].Timestamp
+		if ts.Before(newest.Add(-sb.reorderWindow)) {
+			sb.framesLate.Add(1)
+
+			switch sb.lateness {
+			case LatenessDrop:
+				return Frame{}, false
+			case LatenessClamp:
+				ts = newest
+			}
 		}
 	}
 
-	// store copy of frame data
-	newBuf := sb.bufferPool.get()
-	newBuf = append(newBuf, data...)
+	if sb.count == sb.capacity {
+		// recycle memory from the oldest frame to make room
+		sb.evictOldest()
+	}
+
+	// store copy of frame data; typed frames carry their payload in value
+	var newBuf []byte
+	if in.value == nil {
+		newBuf = sb.newFrameBuffer(len(in.Data))
+		newBuf = append(newBuf, in.Data...)
+	}
+
+	id := in.ID
+	if id == "" {
+		id = sb.makeID()
+	}
 
 	frame := Frame{
+		ID:        id,
 		Data:      newBuf,
-		Timestamp: now,
+		Timestamp: ts,
 		Sequence:  sb.nextSeq,
+		Metadata:  in.Metadata.clone(),
+		Keyframe:  in.Keyframe,
+		ref:       newFrameRef(newBuf, sb.bufferPool),
+		value:     in.value,
 	}
 	sb.nextSeq++
 
 	// add to circular buffer
 	sb.frames[sb.head] = frame
 	sb.head = (sb.head + 1) % sb.capacity
+	sb.count++
+	sb.bytes += cap(newBuf)
+
+	if sb.store != nil && sb.spillMode == SpillAll {
+		sb.queueSpill(&frame)
+	}
 
-	if sb.count < sb.capacity {
-		sb.count++
+	// move the frame back into timestamp order
+	for i := sb.count - 1; i > 0; i-- {
+		prev, cur := sb.index(i-1), sb.index(i)
+		if !sb.frames[prev].Timestamp.After(sb.frames[cur].Timestamp) {
+			break
+		}
+		sb.frames[prev], sb.frames[cur] = sb.frames[cur], sb.frames[prev]
 	}
 
+	newest := sb.frames[sb.index(sb.count-1)].Timestamp
 	sb.framesProcessed.Add(1)
-	sb.lastFrameTime = now
+	if !newest.Equal(sb.lastFrameTime) {
+		sb.lastFrameTime = newest
+		sb.lastFrameAt = sb.clock.Now()
+	}
 
 	// trim frames older than the window duration
-	cutoff := now.Add(-sb.window)
-	oldest := (sb.head - sb.count + sb.capacity) % sb.capacity
-	trimmed := 0
+	sb.trimBefore(newest.Add(-sb.window))
 
-	for i := range sb.count {
-		idx := (oldest + i) % sb.capacity
-		if !sb.frames[idx].Timestamp.Before(cutoff) {
-			break // remaining frames are still within the window
+	// evict the oldest frames until the byte budget is met,
+	// always keeping the newest frame
+	if sb.maxBytes > 0 {
+		for sb.bytes > sb.maxBytes && sb.count > 1 {
+			sb.framesEvicted.Add(uint64(sb.evictOldest()))
 		}
+	}
 
-		// recycle buffer
-		if sb.frames[idx].Data != nil {
-			sb.bufferPool.put(sb.frames[idx].Data)
-			sb.frames[idx].Data = nil
+	if sb.subscriberCount.Load() == 0 && sb.clip == nil {
+		return Frame{}, false
+	}
+	published := frame
+	published.Data = bytes.Clone(newBuf)
+	published.Metadata = frame.Metadata.clone()
+	published.ref = nil
+	return published, true
+}
+
+// expire trims frames that have fallen out of the window according to the
+// stream time. Spilled frames are deleted a segment at a time once they have
+// all expired.
+func (sb *StreamBuffer) expire() {
+	sb.mu.Lock()
+	cutoff := sb.streamTime().Add(-sb.window)
+	sb.trimBefore(cutoff)
+	sb.mu.Unlock()
+
+	if sb.store != nil {
+		if err := sb.store.deleteBefore(cutoff); err != nil {
+			sb.spillErrors.Add(1)
+		}
+	}
+}
+
+// nextTrimDelay returns how long to wait before a trim would remove frames,
+// but no less than the trim interval. It reports false if the buffer is empty.
+func (sb *StreamBuffer) nextTrimDelay() (time.Duration, bool) {
+	sb.mu.RLock()
+	defer sb.mu.RUnlock()
+
+	if sb.count == 0 {
+		return 0, false
+	}
+
+	oldest := 0
+	if sb.keyframes && sb.frameAt(0).Keyframe {
+		// the group of pictures the buffer starts with is trimmed as a whole,
+		// once its last frame expires
+		oldest = sb.count - 1
+		for i := 1; i < sb.count; i++ {
+			if sb.frameAt(i).Keyframe {
+				oldest = i - 1
+				break
+			}
 		}
+	}
+
+	expiry := sb.frameAt(oldest).Timestamp.Add(sb.window)
+	delay := expiry.Sub(sb.streamTime())
+	if delay < sb.trimInterval {
+		delay = sb.trimInterval
+	}
+	return delay, true
+}
+
+// streamTime returns the current time in the time base of frame timestamps:
+// the newest timestamp, advanced by the clock time elapsed since it arrived.
+// Idle streams thus keep expiring, even when capture timestamps lag the
+// clock by more than the window. Must be called with mu held.
+func (sb *StreamBuffer) streamTime() time.Time {
+	if sb.lastFrameTime.IsZero() {
+		return sb.clock.Now()
+	}
+	return sb.lastFrameTime.Add(sb.clock.Now().Sub(sb.lastFrameAt))
+}
+
+// now returns the stream time for callers that do not hold mu.
+func (sb *StreamBuffer) now() time.Time {
+	sb.mu.RLock()
+	defer sb.mu.RUnlock()
+	return sb.streamTime()
+}
+
+// trimBefore removes frames with timestamps before cutoff. With keyframe
+// alignment, the group of pictures the window starts in is kept whole.
+// Must be called with mu held.
+func (sb *StreamBuffer) trimBefore(cutoff time.Time) {
+	// frames are ordered, so the expired ones are a prefix
+	trimmed := 0
+	for trimmed < sb.count && sb.frames[sb.index(trimmed)].Timestamp.Before(cutoff) {
 		trimmed++
 	}
+
+	if sb.keyframes && trimmed < sb.count {
+		if k := keyframeAtOrBefore(sb, trimmed); k >= 0 {
+			trimmed = k
+		}
+	}
+
 	if trimmed > 0 {
-		sb.count -= trimmed
+		sb.removeOldest(trimmed)
 		sb.framesTrimmed.Add(uint64(trimmed))
 	}
 }
 
-// createSnapshot returns a deep copy of the current buffer contents.
-func (sb *StreamBuffer) createSnapshot() *Snapshot {
+// evictOldest removes the oldest frame to make room. With keyframe alignment,
+// the frames up to the next keyframe go with it, so the buffer keeps starting
+// at a keyframe; the newest frame is always kept. It returns the number of
+// frames removed. Must be called with mu held.
+func (sb *StreamBuffer) evictOldest() int {
+	n := 1
+	if sb.keyframes {
+		for i := 1; i < sb.count; i++ {
+			if sb.frames[sb.index(i)].Keyframe {
+				n = i
+				break
+			}
+		}
+	}
+	if sb.store != nil && sb.spillMode == SpillEvicted {
+		for i := range n {
+			sb.queueSpill(sb.frameAt(i))
+		}
+	}
+	sb.removeOldest(n)
+	return n
+}
+
+// removeOldest recycles the n oldest frames. Must be called with mu held.
+func (sb *StreamBuffer) removeOldest(n int) {
+	for i := range n {
+		sb.recycle(sb.index(i))
+	}
+	sb.count -= n
+}
+
+// recycle releases the buffer's hold on the data of the frame at slot idx,
+// returning it to the pool unless a snapshot still shares it.
+// Must be called with mu held.
+func (sb *StreamBuffer) recycle(idx int) {
+	f := &sb.frames[idx]
+	if f.ref != nil {
+		sb.bytes -= cap(f.Data)
+		f.ref.release()
+		f.ref = nil
+		f.Data = nil
+	}
+}
+
+// newFrameBuffer returns an empty buffer to store n bytes of frame data in.
+// Under a byte budget, which counts buffer capacity, a pooled buffer that
+// does not fit n closely is replaced with an exactly sized one, so that
+// small frames do not hold large recycled buffers.
+func (sb *StreamBuffer) newFrameBuffer(n int) []byte {
+	buf := sb.bufferPool.get()
+	if sb.maxBytes > 0 && (cap(buf) < n || cap(buf) > 2*n) {
+		sb.bufferPool.put(buf)
+		buf = make([]byte, 0, n)
+	}
+	return buf
+}
+
+// createSnapshot returns the buffered frames selected by q. Frame data is
+// deep-copied, or shared by reference in zero-copy mode. With a segment
+// store, spilled frames are merged in without their data, which readSpilled
+// reads once the snapshot has left the processing loop.
+func (sb *StreamBuffer) createSnapshot(q snapshotQuery) snapshotResult {
 	sb.mu.RLock()
 	defer sb.mu.RUnlock()
 
-	if sb.count == 0 {
-		return &Snapshot{
-			ID:        sb.makeID(),
-			Frames:    []Frame{},
-			StartTime: time.Time{},
-			EndTime:   time.Time{},
-			Timestamp: time.Now(),
+	var (
+		list    frameList = sb
+		spilled map[uint64]segmentEntry
+	)
+	if sb.store != nil {
+		list, spilled = sb.withSpilled(q)
+		if len(q.where) > 0 && len(spilled) > 0 {
+			// predicates need the data of spilled frames, so they are
+			// applied to them by readSpilled, followed by the limit
+			where := q.where
+			q.where = []func(*Frame) bool{func(f *Frame) bool {
+				if _, ok := spilled[f.Sequence]; ok {
+					return true
+				}
+				return snapshotQuery{where: where}.match(f)
+			}}
+			q.last = 0
 		}
 	}
 
-	frames := make([]Frame, sb.count)
-	oldest := (sb.head - sb.count + sb.capacity) % sb.capacity
-	var startTime, endTime time.Time
+	selected := q.selectFrames(list)
+	gap := q.hasGap(list, sb.nextSeq)
+
+	if len(selected) == 0 {
+		return snapshotResult{
+			snapshot: &Snapshot{
+				ID:        sb.makeID(),
+				Frames:    []Frame{},
+				StartTime: time.Time{},
+				EndTime:   time.Time{},
+				Timestamp: sb.clock.Now(),
+			},
+			gap: gap,
+		}
+	}
 
-	for i := range sb.count {
-		srcIdx := (oldest + i) % sb.capacity
-		srcFrame := sb.frames[srcIdx]
+	snapshot := Snapshot{
+		ID:        sb.makeID(),
+		Frames:    make([]Frame, len(selected)),
+		Timestamp: sb.clock.Now(),
+	}
+	if !sb.zeroCopy {
+		snapshot.pool = sb.bufferPool
+	}
 
-		// make a deep copy of frame data
-		dataCopy := sb.bufferPool.get()
-		dataCopy = append(dataCopy, srcFrame.Data...)
+	var pending []spilledFrame
+	frames := snapshot.Frames
+	for i, pos := range selected {
+		srcFrame := *list.frameAt(pos)
 
 		frames[i] = Frame{
-			ID:        sb.makeID(),
-			Data:      dataCopy,
+			ID:        srcFrame.ID,
 			Timestamp: srcFrame.Timestamp,
 			Sequence:  srcFrame.Sequence,
+			Metadata:  srcFrame.Metadata.clone(),
+			Keyframe:  srcFrame.Keyframe,
+			value:     srcFrame.value,
 		}
-		if i == 0 {
-			startTime = srcFrame.Timestamp
+
+		if srcFrame.value != nil {
+			continue // typed payloads are cloned by TypedBuffer
 		}
-		if i == sb.count-1 {
-			endTime = srcFrame.Timestamp
+
+		if e, ok := spilled[srcFrame.Sequence]; ok {
+			pending = append(pending, spilledFrame{index: i, entry: e})
+			continue
 		}
+
+		if sb.zeroCopy {
+			// share the buffer until the snapshot is released
+			srcFrame.ref.retain()
+			frames[i].Data = srcFrame.ref.view()
+			frames[i].ref = srcFrame.ref
+			continue
+		}
+
+		// make a deep copy of frame data
+		dataCopy := sb.bufferPool.get()
+		dataCopy = append(dataCopy, srcFrame.Data...)
+		frames[i].Data = dataCopy
 	}
-	return &Snapshot{
-		ID:        sb.makeID(),
-		Frames:    frames,
-		StartTime: startTime,
-		EndTime:   endTime,
-		Timestamp: time.Now(),
-	}
+
+	snapshot.StartTime = frames[0].Timestamp
+	snapshot.EndTime = frames[len(frames)-1].Timestamp
+	return snapshotResult{snapshot: &snapshot, gap: gap, spilled: pending}
 }
 
 // Input returns the channel to which data should be sent.
-// The StreamBuffer will continuously process data from this channel.
+// The StreamBuffer will continuously process data from this channel, queueing
+// it under the backpressure policy as Push does.
 func (sb *StreamBuffer) Input() chan<- []byte {
 	return sb.input
 }
 
+// InputFrames returns the channel to which timestamped frames should be sent.
+// The frame's Timestamp is kept as its capture time and drives window trimming,
+// so queueing delay does not skew the window. A zero Timestamp is replaced with
+// the time the frame is processed. Data and Metadata are copied; Sequence is assigned by the buffer.
+// Like Input, frames are queued under the backpressure policy as PushFrame does.
+func (sb *StreamBuffer) InputFrames() chan<- Frame {
+	return sb.frameInput
+}
+
 // GetSnapshot returns a point-in-time copy of the buffer contents.
 // It respects context cancellation for timeout support.
-func (sb *StreamBuffer) GetSnapshot(ctx context.Context) (*Snapshot, error) {
+func (sb *StreamBuffer) GetSnapshot(ctx context.Context, opts ...SnapshotOption) (*Snapshot, error) {
+	return sb.requestSnapshot(ctx, newSnapshotQuery(opts))
+}
+
+// requestSnapshot asks the processing loop for a snapshot of the frames selected by q.
+func (sb *StreamBuffer) requestSnapshot(ctx context.Context, q snapshotQuery) (*Snapshot, error) {
+	result, err := sb.requestSnapshotResult(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return result.snapshot, nil
+}
+
+// requestSnapshotResult is like requestSnapshot but returns the full result.
+func (sb *StreamBuffer) requestSnapshotResult(ctx context.Context, q snapshotQuery) (snapshotResult, error) {
 	if !sb.running.Load() || sb.finalStopped.Load() {
-		return nil, errors.New("stream buffer is not running")
+		return snapshotResult{}, errors.New("stream buffer is not running")
 	}
 
 	sb.shutdownMu.Lock()
@@ -330,39 +736,58 @@ func (sb *StreamBuffer) GetSnapshot(ctx context.Context) (*Snapshot, error) {
 	sb.shutdownMu.Unlock()
 
 	if !hasShutdown {
-		return nil, errors.New("stream buffer is shutting down")
+		return snapshotResult{}, errors.New("stream buffer is shutting down")
 	}
 
-	resultChan := make(chan *Snapshot, 1)
+	resultChan := make(chan snapshotResult, 1)
 	req := snapshotRequest{
 		resultChan: resultChan,
 		ctx:        ctx,
+		query:      q,
 	}
 
 	select {
 	case sb.snapReq <- req:
 	case <-ctx.Done():
-		return nil, ctx.Err()
+		return snapshotResult{}, ctx.Err()
 	}
 
 	select {
-	case snapshot := <-resultChan:
-		return snapshot, nil
+	case result := <-resultChan:
+		if result.err == nil && sb.store != nil {
+			result.err = sb.readSpilled(result.snapshot, result.spilled, q)
+		}
+		return result, result.err
 	case <-ctx.Done():
-		return nil, ctx.Err()
+		return snapshotResult{}, ctx.Err()
 	}
 }
 
 // Metrics contains performance statistics for a StreamBuffer.
 type Metrics struct {
 	FramesProcessed   uint64        // total frames added
-	FramesDropped     uint64        // frames dropped due to buffer full
+	FramesDropped     uint64        // frames rejected by Push or TryPush
+	PushesBlocked     uint64        // pushes that waited for room under BackpressureBlock
+	DroppedNewest     uint64        // incoming frames dropped because the input was full
+	DroppedOldest     uint64        // queued frames displaced under BackpressureDropOldest or BackpressureSample
+	SampledOut        uint64        // frames skipped under BackpressureSample
 	FramesTrimmed     uint64        // frames removed due to age
+	FramesLate        uint64        // frames that arrived beyond the reorder window
+	FramesEvicted     uint64        // frames removed to stay within the byte budget
 	SnapshotsSent     uint64        // snapshots successfully delivered
+	SubscriberDrops   uint64        // frames not delivered to slow subscribers
+	ClipsSent         uint64        // clips delivered to triggers
+	TriggersPending   int           // triggers waiting for their clip to complete
+	FramesSpilled     uint64        // frames written to the segment store
+	SpillErrors       uint64        // failed segment store writes and deletions
+	FramesRecovered   uint64        // frames restored from the write-ahead log
+	Subscribers       int           // current subscription count
 	BufferUtilization float64       // current buffer fullness (0.0-1.0)
 	Uptime            time.Duration // time since creation
 	FrameCount        int           // current frame count
 	Capacity          int           // maximum frames
+	BytesStored       int           // memory held by stored frame data
+	MaxBytes          int           // byte budget, 0 if unlimited
 	WindowDuration    time.Duration // retention window
 	LastFrameTime     time.Time     // timestamp of newest frame
 }
@@ -372,6 +797,8 @@ func (sb *StreamBuffer) GetMetrics() Metrics {
 	sb.mu.RLock()
 	count := sb.count
 	capacity := sb.capacity
+	bytes := sb.bytes
+	lastFrameTime := sb.lastFrameTime
 	sb.mu.RUnlock()
 
 	var utilization float64
@@ -381,14 +808,29 @@ func (sb *StreamBuffer) GetMetrics() Metrics {
 	return Metrics{
 		FramesProcessed:   sb.framesProcessed.Load(),
 		FramesDropped:     sb.framesDropped.Load(),
+		PushesBlocked:     sb.pushesBlocked.Load(),
+		DroppedNewest:     sb.framesDroppedNewest.Load(),
+		DroppedOldest:     sb.framesDroppedOldest.Load(),
+		SampledOut:        sb.framesSampledOut.Load(),
 		FramesTrimmed:     sb.framesTrimmed.Load(),
+		FramesLate:        sb.framesLate.Load(),
+		FramesEvicted:     sb.framesEvicted.Load(),
 		SnapshotsSent:     sb.snapshotsSent.Load(),
+		SubscriberDrops:   sb.subscriberDrops.Load(),
+		ClipsSent:         sb.clipsSent.Load(),
+		TriggersPending:   int(sb.triggersPending.Load()),
+		FramesSpilled:     sb.framesSpilled.Load(),
+		SpillErrors:       sb.spillErrors.Load(),
+		FramesRecovered:   sb.framesRecovered.Load(),
+		Subscribers:       int(sb.subscriberCount.Load()),
 		BufferUtilization: utilization,
-		Uptime:            time.Since(sb.creationTime),
+		Uptime:            sb.clock.Now().Sub(sb.creationTime),
 		FrameCount:        count,
 		Capacity:          capacity,
+		BytesStored:       bytes,
+		MaxBytes:          sb.maxBytes,
 		WindowDuration:    sb.window,
-		LastFrameTime:     sb.lastFrameTime,
+		LastFrameTime:     lastFrameTime,
 	}
 }
 
@@ -397,6 +839,21 @@ func (sb *StreamBuffer) IsRunning() bool {
 	return sb.running.Load() && !sb.finalStopped.Load()
 }
 
+// frameCount returns the number of buffered frames. Must be called with mu held.
+func (sb *StreamBuffer) frameCount() int {
+	return sb.count
+}
+
+// frameAt returns the buffered frame at logical position i. Must be called with mu held.
+func (sb *StreamBuffer) frameAt(i int) *Frame {
+	return &sb.frames[sb.index(i)]
+}
+
+// index maps a logical position (0 is the oldest frame) to a slot in the circular buffer.
+func (sb *StreamBuffer) index(i int) int {
+	return (sb.head - sb.count + i + sb.capacity) % sb.capacity
+}
+
 func (sb *StreamBuffer) makeID() string {
-	return ulid.MustNew(ulid.Timestamp(time.Now()), sb.entropy).String()
+	return ulid.MustNew(ulid.Timestamp(sb.clock.Now()), sb.entropy).String()
 }
@@ -14,6 +14,17 @@ func WithWindow(d time.Duration) StreamBufferOption {
 	}
 }
 
+// WithTrimInterval sets the minimum delay between background trims.
+// Frames are expired when the oldest one leaves the window, checked no more
+// often than this interval, even if no new frames arrive.
+func WithTrimInterval(d time.Duration) StreamBufferOption {
+	return func(sb *StreamBuffer) {
+		if d > 0 {
+			sb.trimInterval = d
+		}
+	}
+}
+
 // WithCapacity sets the maximum number of frames the buffer can hold.
 func WithCapacity(n int) StreamBufferOption {
 	return func(sb *StreamBuffer) {
@@ -23,6 +34,19 @@ func WithCapacity(n int) StreamBufferOption {
 	}
 }
 
+// WithMaxBytes sets a budget for the memory held by stored frame data,
+// counting the capacity of each frame's buffer. Frames are stored in buffers
+// sized to fit them rather than in larger recycled ones. The oldest frames
+// are evicted until the budget is met; the newest frame is always kept, so
+// pair it with WithMaxFrameSize for a hard limit.
+func WithMaxBytes(n int) StreamBufferOption {
+	return func(sb *StreamBuffer) {
+		if n > 0 {
+			sb.maxBytes = n
+		}
+	}
+}
+
 // WithFrameSize sets the expected frame size hint for memory allocation.
 func WithFrameSize(size int) StreamBufferOption {
 	return func(sb *StreamBuffer) {
@@ -32,6 +56,16 @@ func WithFrameSize(size int) StreamBufferOption {
 	}
 }
 
+// WithMaxFrameSize sets the largest frame accepted by Push, TryPush and the input channels.
+// Larger frames are dropped with DropOversize.
+func WithMaxFrameSize(size int) StreamBufferOption {
+	return func(sb *StreamBuffer) {
+		if size > 0 {
+			sb.maxFrameSize = size
+		}
+	}
+}
+
 // WithMaxRecycleSize sets the maximum buffer size to recycle.
 func WithMaxRecycleSize(size int) StreamBufferOption {
 	return func(sb *StreamBuffer) {
@@ -41,7 +75,7 @@ func WithMaxRecycleSize(size int) StreamBufferOption {
 	}
 }
 
-// WithInputBuffer sets the input channel buffer capacity.
+// WithInputBuffer sets the capacity of the input queue and channels.
 func WithInputBuffer(size int) StreamBufferOption {
 	return func(sb *StreamBuffer) {
 		if sb.input == nil && size > 0 {
@@ -49,3 +83,103 @@ func WithInputBuffer(size int) StreamBufferOption {
 		}
 	}
 }
+
+// WithReorderWindow sets how far behind the newest frame a frame may arrive
+// and still be treated as reordered rather than late.
+func WithReorderWindow(d time.Duration) StreamBufferOption {
+	return func(sb *StreamBuffer) {
+		if d > 0 {
+			sb.reorderWindow = d
+		}
+	}
+}
+
+// WithLatenessPolicy sets how frames arriving beyond the reorder window are handled.
+func WithLatenessPolicy(p LatenessPolicy) StreamBufferOption {
+	return func(sb *StreamBuffer) {
+		sb.lateness = p
+	}
+}
+
+// WithClock sets the time source used for stamping frames, trimming and metrics.
+func WithClock(c Clock) StreamBufferOption {
+	return func(sb *StreamBuffer) {
+		if c != nil {
+			sb.clock = c
+		}
+	}
+}
+
+// WithDropHandler sets a function called for every frame dropped by Push or TryPush.
+// It runs on the pushing goroutine and must not block.
+func WithDropHandler(fn func(reason DropReason, data []byte)) StreamBufferOption {
+	return func(sb *StreamBuffer) {
+		sb.dropHandler = fn
+	}
+}
+
+// WithBackpressure sets what happens to incoming frames when the input queue is full.
+func WithBackpressure(p BackpressurePolicy) StreamBufferOption {
+	return func(sb *StreamBuffer) {
+		sb.backpressure = p
+	}
+}
+
+// WithSampleEvery sets N for BackpressureSample: while the input is full,
+// one in every N pushed frames is kept.
+func WithSampleEvery(n int) StreamBufferOption {
+	return func(sb *StreamBuffer) {
+		if n > 0 {
+			sb.sampleEvery = n
+		}
+	}
+}
+
+// WithKeyframeAlignment makes eviction respect frames marked as keyframes:
+// trimming keeps the whole group of pictures the window starts in, and
+// forced evictions remove a whole group at a time, so the buffer always
+// starts at a keyframe once one has been stored.
+func WithKeyframeAlignment() StreamBufferOption {
+	return func(sb *StreamBuffer) {
+		sb.keyframes = true
+	}
+}
+
+// WithSpill adds a disk tier to the buffer: frames selected by mode are
+// written to store, and snapshot and range queries read them back merged with
+// the frames in memory. Spilled frames are deleted once they leave the window.
+// New frames are sequenced after the highest one already in the store, so
+// frames spilled by an earlier run remain distinct and visible to queries
+// while they are within the window.
+// Subscriptions, clips and All see only the frames in memory.
+// The store is not closed when the buffer stops.
+func WithSpill(store *SegmentStore, mode SpillMode) StreamBufferOption {
+	return func(sb *StreamBuffer) {
+		sb.store = store
+		sb.spillMode = mode
+	}
+}
+
+// WithWAL uses store as a write-ahead log: every frame is written to it as it
+// is stored, and a new buffer restores the frames still within the window
+// from it, keeping their ID, Timestamp and Sequence. New frames are sequenced
+// after the highest recovered one. Recovered frames that do not fit within
+// the capacity or byte budget stay on disk and remain visible to queries, as
+// with WithSpill. Use WithSyncWrites on the store to survive power loss.
+// A TypedBuffer ignores it, as its values are not serialized.
+func WithWAL(store *SegmentStore) StreamBufferOption {
+	return func(sb *StreamBuffer) {
+		sb.store = store
+		sb.spillMode = SpillAll
+		sb.recoverFrames = true
+	}
+}
+
+// WithZeroCopySnapshots makes snapshots share frame data with the buffer
+// instead of copying it. Shared data is read-only and stays valid until the
+// snapshot is released with Snapshot.Release, even if the frame is evicted.
+func WithZeroCopySnapshots() StreamBufferOption {
+	return func(sb *StreamBuffer) {
+		sb.zeroCopy = true
+	}
+}
@@ -8,10 +8,62 @@ import (
 	"testing"
 	"time"
 
+	"github.com/alesr/tidstrom/tidstromtest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+var _ Clock = (*tidstromtest.Clock)(nil)
+
+// newTestBuffer returns a started buffer holding ten frames captured one
+// second apart, with keyframes at frames 2 and 6, and its clock one second
+// past the last frame. opts are applied after the test defaults.
+func newTestBuffer(t *testing.T, opts ...StreamBufferOption) (*StreamBuffer, *tidstromtest.Clock, time.Time) {
+	t.Helper()
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := tidstromtest.NewClock(base.Add(9 * time.Second))
+
+	sb := NewStreamBuffer(append([]StreamBufferOption{
+		WithWindow(time.Hour),
+		WithClock(clock),
+	}, opts...)...)
+	sb.Start()
+	t.Cleanup(sb.Stop)
+
+	pushGOPs(t, sb, base, 0, 10, 2, 6)
+	clock.Advance(time.Second)
+	return sb, clock, base
+}
+
+// testSnapshot returns a snapshot of frames holding the given payloads,
+// captured interval apart. Every frame field is set, and the first frame
+// is a keyframe with metadata.
+func testSnapshot(interval time.Duration, payloads ...[]byte) *Snapshot {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	frames := make([]Frame, len(payloads))
+	for i, data := range payloads {
+		frames[i] = Frame{
+			ID:        fmt.Sprintf("%02d", i+1),
+			Data:      data,
+			Timestamp: base.Add(time.Duration(i) * interval),
+			Sequence:  uint64(10 + i),
+		}
+	}
+	frames[0].Metadata = Metadata{"source": "test"}
+	frames[0].Keyframe = true
+
+	last := frames[len(frames)-1].Timestamp
+	return &Snapshot{
+		ID:        "snapshot",
+		Frames:    frames,
+		StartTime: base,
+		EndTime:   last,
+		Timestamp: last.Add(interval),
+	}
+}
+
 func TestStreamBufferInitialization(t *testing.T) {
 	// test default settings
 	sb := NewStreamBuffer()
@@ -370,3 +422,398 @@ func TestBufferPoolRecycling(t *testing.T) {
 	assert.Equal(t, 1024, len(snapshot.Frames[0].Data), "first frame should be small")
 	assert.Equal(t, 3*1024*1024, len(snapshot.Frames[1].Data), "second frame should be large")
 }
+
+func TestStreamBufferEventTimestamps(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	sb := NewStreamBuffer(
+		WithWindow(2*time.Second),
+		WithCapacity(100),
+		WithClock(tidstromtest.NewClock(base.Add(4*time.Second))),
+	)
+	sb.Start()
+	defer sb.Stop()
+
+	input := sb.InputFrames()
+
+	// capture times far from wall clock time, spaced 1s apart
+	for i := range 5 {
+		input <- Frame{
+			Data:      fmt.Appendf(nil, "Frame %d", i),
+			Timestamp: base.Add(time.Duration(i) * time.Second),
+		}
+	}
+
+	require.Eventually(t, func() bool {
+		return sb.GetMetrics().FramesProcessed == 5
+	}, time.Second, 5*time.Millisecond)
+
+	snapshot, err := sb.GetSnapshot(context.Background())
+	require.NoError(t, err)
+
+	// frames 0 and 1 are older than 2s relative to the newest capture time
+	require.Len(t, snapshot.Frames, 3, "frames outside the event-time window should be trimmed")
+	for i, frame := range snapshot.Frames {
+		assert.Equal(t, fmt.Sprintf("Frame %d", i+2), string(frame.Data))
+		assert.True(t, base.Add(time.Duration(i+2)*time.Second).Equal(frame.Timestamp),
+			"frame should keep its capture timestamp")
+	}
+
+	assert.True(t, base.Add(2*time.Second).Equal(snapshot.StartTime))
+	assert.True(t, base.Add(4*time.Second).Equal(snapshot.EndTime))
+
+	metrics := sb.GetMetrics()
+	assert.Equal(t, uint64(2), metrics.FramesTrimmed, "should have trimmed 2 frames")
+	assert.True(t, base.Add(4*time.Second).Equal(metrics.LastFrameTime))
+}
+
+func TestStreamBufferOutOfOrderFrames(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time {
+		return base.Add(time.Duration(ms) * time.Millisecond)
+	}
+
+	testCases := []struct {
+		name         string
+		policy       LatenessPolicy
+		expectedData []string
+	}{
+		{
+			name:         "Accept",
+			policy:       LatenessAccept,
+			expectedData: []string{"t0", "late", "t1000", "t1500", "t2000"},
+		},
+		{
+			name:         "Drop",
+			policy:       LatenessDrop,
+			expectedData: []string{"t0", "t1000", "t1500", "t2000"},
+		},
+		{
+			name:         "Clamp",
+			policy:       LatenessClamp,
+			expectedData: []string{"t0", "t1000", "t1500", "t2000", "late"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sb := NewStreamBuffer(
+				WithWindow(time.Hour),
+				WithReorderWindow(time.Second),
+				WithLatenessPolicy(tc.policy),
+				WithClock(tidstromtest.NewClock(at(2000))),
+			)
+			sb.Start()
+			defer sb.Stop()
+
+			input := sb.InputFrames()
+			input <- Frame{Data: []byte("t0"), Timestamp: at(0)}
+			input <- Frame{Data: []byte("t2000"), Timestamp: at(2000)}
+			input <- Frame{Data: []byte("t1000"), Timestamp: at(1000)} // reordered
+			input <- Frame{Data: []byte("t1500"), Timestamp: at(1500)} // reordered
+			input <- Frame{Data: []byte("late"), Timestamp: at(500)}   // beyond reorder window
+
+			// the late frame is the last one sent, so all frames are handled once it is counted
+			require.Eventually(t, func() bool {
+				return sb.GetMetrics().FramesLate == 1
+			}, time.Second, 5*time.Millisecond)
+
+			snapshot, err := sb.GetSnapshot(context.Background())
+			require.NoError(t, err)
+
+			var data []string
+			for i, frame := range snapshot.Frames {
+				data = append(data, string(frame.Data))
+				if i > 0 {
+					assert.False(t, frame.Timestamp.Before(snapshot.Frames[i-1].Timestamp),
+						"frames should be ordered by timestamp")
+				}
+			}
+			assert.Equal(t, tc.expectedData, data)
+			assert.Equal(t, uint64(1), sb.GetMetrics().FramesLate, "should count one late frame")
+		})
+	}
+}
+
+func TestStreamBufferTimeWindowTrimmingWithClock(t *testing.T) {
+	clock := tidstromtest.NewClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	sb := NewStreamBuffer(
+		WithWindow(2*time.Second),
+		WithCapacity(100),
+		WithClock(clock),
+	)
+	sb.Start()
+	defer sb.Stop()
+
+	input := sb.Input()
+	send := func(prefix string, total uint64) {
+		for i := range 5 {
+			input <- fmt.Appendf(nil, "%s frame %d", prefix, i)
+		}
+		require.Eventually(t, func() bool {
+			return sb.GetMetrics().FramesProcessed == total
+		}, time.Second, time.Millisecond)
+	}
+
+	send("Early", 5)
+	clock.Advance(1500 * time.Millisecond)
+	send("Middle", 10)
+	clock.Advance(1000 * time.Millisecond) // early frames now outside the 2s window
+	send("Late", 15)
+
+	snapshot, err := sb.GetSnapshot(context.Background())
+	require.NoError(t, err)
+
+	require.Len(t, snapshot.Frames, 10, "should have 10 frames (middle + late)")
+	for _, frame := range snapshot.Frames {
+		assert.NotContains(t, string(frame.Data), "Early frame", "early frames should have been trimmed")
+	}
+	assert.Equal(t, clock.Now(), snapshot.Timestamp, "snapshot should be stamped by the clock")
+
+	metrics := sb.GetMetrics()
+	assert.Equal(t, uint64(5), metrics.FramesTrimmed, "should have trimmed 5 frames")
+	assert.Equal(t, 2500*time.Millisecond, metrics.Uptime, "uptime should follow the clock")
+}
+
+func TestStreamBufferBackgroundTrimming(t *testing.T) {
+	clock := tidstromtest.NewClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	sb := NewStreamBuffer(
+		WithWindow(2*time.Second),
+		WithTrimInterval(100*time.Millisecond),
+		WithClock(clock),
+	)
+	sb.Start()
+	defer sb.Stop()
+
+	input := sb.Input()
+	input <- []byte("Frame 0")
+	require.Eventually(t, func() bool {
+		return sb.GetMetrics().FramesProcessed == 1
+	}, time.Second, time.Millisecond)
+
+	clock.Advance(time.Second)
+	input <- []byte("Frame 1")
+	require.Eventually(t, func() bool {
+		return sb.GetMetrics().FramesProcessed == 2
+	}, time.Second, time.Millisecond)
+
+	// no frames arrive while time passes; the first frame expires at 2s
+	clock.Advance(1500 * time.Millisecond)
+	require.Eventually(t, func() bool {
+		return sb.GetMetrics().FramesTrimmed == 1
+	}, time.Second, time.Millisecond, "idle stream should expire the oldest frame")
+	assert.Equal(t, 1, sb.GetMetrics().FrameCount)
+
+	// the second frame expires at 3s
+	clock.Advance(time.Second)
+	require.Eventually(t, func() bool {
+		return sb.GetMetrics().FramesTrimmed == 2
+	}, time.Second, time.Millisecond, "idle stream should expire all frames")
+
+	snapshot, err := sb.GetSnapshot(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, snapshot.Frames, "snapshot should not contain expired frames")
+}
+
+func TestStreamBufferLaggingCaptureClock(t *testing.T) {
+	clock := tidstromtest.NewClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	sb := NewStreamBuffer(
+		WithWindow(2*time.Second),
+		WithTrimInterval(100*time.Millisecond),
+		WithClock(clock),
+	)
+	sb.Start()
+	defer sb.Stop()
+
+	// capture timestamps an hour behind the buffer's clock
+	base := clock.Now().Add(-time.Hour)
+	for i := range 5 {
+		sb.InputFrames() <- Frame{
+			Data:      fmt.Appendf(nil, "Frame %d", i),
+			Timestamp: base.Add(time.Duration(i) * 100 * time.Millisecond),
+		}
+	}
+	require.Eventually(t, func() bool {
+		return sb.GetMetrics().FramesProcessed == 5
+	}, time.Second, time.Millisecond)
+
+	snapshot, err := sb.GetSnapshot(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, snapshot.Frames, 5, "frames within the window of their own time base should be kept")
+	assert.Zero(t, sb.GetMetrics().FramesTrimmed)
+
+	// once the stream idles past the window, the frames expire
+	clock.Advance(3 * time.Second)
+	require.Eventually(t, func() bool {
+		return sb.GetMetrics().FramesTrimmed == 5
+	}, time.Second, time.Millisecond, "idle stream should expire frames in stream time")
+}
+
+func TestStreamBufferSnapshotExpiresFrames(t *testing.T) {
+	clock := tidstromtest.NewClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	sb := NewStreamBuffer(
+		WithWindow(2*time.Second),
+		WithTrimInterval(time.Hour), // keep the background trim from running
+		WithClock(clock),
+	)
+	sb.Start()
+	defer sb.Stop()
+
+	sb.Input() <- []byte("Frame 0")
+	require.Eventually(t, func() bool {
+		return sb.GetMetrics().FramesProcessed == 1
+	}, time.Second, time.Millisecond)
+
+	clock.Advance(3 * time.Second)
+
+	snapshot, err := sb.GetSnapshot(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, snapshot.Frames, "snapshot should not contain frames older than the window")
+	assert.Equal(t, uint64(1), sb.GetMetrics().FramesTrimmed)
+}
+
+func TestStreamBufferByteBudget(t *testing.T) {
+	sb := NewStreamBuffer(
+		WithWindow(time.Hour),
+		WithCapacity(100),
+		WithMaxBytes(1000),
+	)
+	sb.Start()
+	defer sb.Stop()
+
+	// four 300-byte frames fit within 1000 bytes three at a time
+	for i := range 4 {
+		data := make([]byte, 300)
+		data[0] = byte(i)
+		require.NoError(t, sb.Push(context.Background(), data))
+	}
+	require.Eventually(t, func() bool {
+		return sb.GetMetrics().FramesProcessed == 4
+	}, time.Second, time.Millisecond)
+
+	snapshot, err := sb.GetSnapshot(context.Background())
+	require.NoError(t, err)
+	require.Len(t, snapshot.Frames, 3, "oldest frame should be evicted to fit the budget")
+	for i, frame := range snapshot.Frames {
+		assert.Equal(t, byte(i+1), frame.Data[0], "newest frames should remain")
+	}
+
+	metrics := sb.GetMetrics()
+	assert.Equal(t, 900, metrics.BytesStored)
+	assert.Equal(t, 1000, metrics.MaxBytes)
+	assert.Equal(t, uint64(1), metrics.FramesEvicted)
+
+	// a frame larger than the budget evicts everything else but is kept
+	require.NoError(t, sb.Push(context.Background(), make([]byte, 1500)))
+	require.Eventually(t, func() bool {
+		return sb.GetMetrics().FramesProcessed == 5
+	}, time.Second, time.Millisecond)
+
+	metrics = sb.GetMetrics()
+	assert.Equal(t, 1, metrics.FrameCount)
+	assert.Equal(t, 1500, metrics.BytesStored)
+	assert.Equal(t, uint64(4), metrics.FramesEvicted)
+}
+
+func TestStreamBufferByteBudgetCountsCapacity(t *testing.T) {
+	sb := NewStreamBuffer(
+		WithWindow(time.Hour),
+		WithCapacity(1000),
+		WithMaxBytes(1<<20),
+	)
+	sb.Start()
+	defer sb.Stop()
+
+	// large frames leave large buffers in the pool for the small ones after them
+	for range 3 {
+		require.NoError(t, sb.Push(context.Background(), make([]byte, 4<<20)))
+	}
+	for range 500 {
+		require.NoError(t, sb.Push(context.Background(), make([]byte, 1000)))
+	}
+	require.Eventually(t, func() bool {
+		return sb.GetMetrics().FramesProcessed == 503
+	}, 5*time.Second, time.Millisecond)
+
+	sb.mu.RLock()
+	var retained int
+	for i := range sb.count {
+		retained += cap(sb.frameAt(i).Data)
+	}
+	count := sb.count
+	sb.mu.RUnlock()
+
+	metrics := sb.GetMetrics()
+	assert.Equal(t, 500, count, "small frames should all fit once the large ones are evicted")
+	assert.Equal(t, retained, metrics.BytesStored, "stored bytes should count buffer capacity")
+	assert.LessOrEqual(t, retained, 1<<20, "buffers held by stored frames should fit the budget")
+}
+
+func TestStreamBufferZeroCopySnapshots(t *testing.T) {
+	sb := NewStreamBuffer(
+		WithWindow(time.Hour),
+		WithCapacity(2),
+		WithZeroCopySnapshots(),
+	)
+	sb.Start()
+	defer sb.Stop()
+
+	for i := range 2 {
+		require.NoError(t, sb.Push(context.Background(), fmt.Appendf(nil, "Frame %d", i)))
+	}
+	require.Eventually(t, func() bool {
+		return sb.GetMetrics().FramesProcessed == 2
+	}, time.Second, time.Millisecond)
+
+	first, err := sb.GetSnapshot(context.Background())
+	require.NoError(t, err)
+	second, err := sb.GetSnapshot(context.Background())
+	require.NoError(t, err)
+
+	require.Len(t, first.Frames, 2)
+	ref := first.Frames[0].ref
+	require.NotNil(t, ref, "zero-copy frames should share the buffer's reference")
+	assert.Same(t, ref, second.Frames[0].ref, "snapshots should share the same buffer")
+	assert.Same(t, &ref.data[0], &first.Frames[0].Data[0], "frame data should not be copied")
+	assert.Equal(t, int32(3), ref.refs.Load(), "buffer and both snapshots should hold the frame")
+
+	// evict the first frame while snapshots still hold it
+	require.NoError(t, sb.Push(context.Background(), []byte("Frame 2")))
+	require.Eventually(t, func() bool {
+		return sb.GetMetrics().FramesProcessed == 3
+	}, time.Second, time.Millisecond)
+
+	assert.Equal(t, int32(2), ref.refs.Load(), "eviction should drop the buffer's hold")
+	assert.Equal(t, "Frame 0", string(first.Frames[0].Data), "data should stay valid until released")
+
+	first.Release()
+	assert.Nil(t, first.Frames[0].Data, "released frames should not expose data")
+	assert.Equal(t, "Frame 0", string(second.Frames[0].Data), "other snapshots should be unaffected")
+
+	second.Release()
+	second.Release() // releasing twice has no effect
+	assert.Equal(t, int32(0), ref.refs.Load(), "last release should recycle the buffer")
+}
+
+func TestSnapshotReleaseCopies(t *testing.T) {
+	sb := NewStreamBuffer()
+	sb.Start()
+	defer sb.Stop()
+
+	require.NoError(t, sb.Push(context.Background(), []byte("Frame 0")))
+	require.Eventually(t, func() bool {
+		return sb.GetMetrics().FramesProcessed == 1
+	}, time.Second, time.Millisecond)
+
+	snapshot, err := sb.GetSnapshot(context.Background())
+	require.NoError(t, err)
+	require.Len(t, snapshot.Frames, 1)
+	assert.Nil(t, snapshot.Frames[0].ref, "copied frames should not share the buffer")
+
+	snapshot.Release()
+	assert.Nil(t, snapshot.Frames[0].Data, "released copies should be returned to the pool")
+
+	// the buffered frame is unaffected
+	snapshot, err = sb.GetSnapshot(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "Frame 0", string(snapshot.Frames[0].Data))
+}
@@ -0,0 +1,214 @@
+package tidstrom
+
+import (
+	"bytes"
+	"context"
+	"time"
+)
+
+// defaultSubscriberBuffer is the default per-subscriber channel capacity.
+const defaultSubscriberBuffer = 64
+
+// SlowSubscriberPolicy controls what happens when a subscriber's channel is full.
+type SlowSubscriberPolicy int
+
+const (
+	// SlowSubscriberDrop skips frames the subscriber has no room for.
+	SlowSubscriberDrop SlowSubscriberPolicy = iota
+	// SlowSubscriberDisconnect closes the subscription.
+	SlowSubscriberDisconnect
+	// SlowSubscriberBlock waits for room, stalling ingestion until the
+	// subscriber catches up or its context is done.
+	SlowSubscriberBlock
+)
+
+// SubscribeOptions configures a subscription.
+type SubscribeOptions struct {
+	Buffer int                  // channel capacity, defaults to 64
+	Policy SlowSubscriberPolicy // handling of a full channel
+	Start  SubscribeStart       // where delivery begins, live frames by default
+
+	// Metadata restricts delivery to frames whose metadata contains
+	// every key/value pair it holds. Nil delivers all frames.
+	Metadata Metadata
+}
+
+// SubscribeStart selects where a subscription begins.
+// The zero value delivers only frames stored after subscribing.
+type SubscribeStart struct {
+	kind      startKind
+	sequence  uint64
+	timestamp time.Time
+}
+
+// startKind identifies the SubscribeStart variant.
+type startKind int
+
+const (
+	startLive startKind = iota
+	startSequence
+	startTime
+)
+
+// StartAtSequence replays buffered frames with a Sequence of seq or higher before following live frames.
+func StartAtSequence(seq uint64) SubscribeStart {
+	return SubscribeStart{kind: startSequence, sequence: seq}
+}
+
+// StartAtTime replays buffered frames with a Timestamp at or after t before following live frames.
+func StartAtTime(t time.Time) SubscribeStart {
+	return SubscribeStart{kind: startTime, timestamp: t}
+}
+
+// query returns the snapshot query selecting the frames to replay.
+func (s SubscribeStart) query() snapshotQuery {
+	switch s.kind {
+	case startSequence:
+		return snapshotQuery{since: s.sequence, hasSince: true}
+	default:
+		return snapshotQuery{from: s.timestamp}
+	}
+}
+
+// subscriber is a registered subscription.
+type subscriber struct {
+	ch       chan Frame
+	ctx      context.Context
+	policy   SlowSubscriberPolicy
+	metadata Metadata      // required frame attributes
+	liveFrom uint64        // first sequence delivered live, older ones were replayed
+	done     chan struct{} // closed when the subscription ends
+}
+
+// Subscribe returns a channel that receives each frame as it is stored, in
+// arrival order. Frame data is a private copy shared by all subscribers and
+// must not be modified. The channel is closed when ctx is done, the buffer is
+// stopped or, under SlowSubscriberDisconnect, the subscriber falls behind.
+//
+// With opts.Start set, matching buffered frames are replayed first in
+// timestamp order, followed by live frames without duplicates or gaps.
+func (sb *StreamBuffer) Subscribe(ctx context.Context, opts SubscribeOptions) (<-chan Frame, error) {
+	if sb.finalStopped.Load() {
+		return nil, ErrStopped
+	}
+
+	size := opts.Buffer
+	if size <= 0 {
+		size = defaultSubscriberBuffer
+	}
+
+	// holding mu keeps frames from being stored between reading the
+	// history and registering, so the handoff to live frames is exact
+	sb.mu.RLock()
+	defer sb.mu.RUnlock()
+
+	var history []Frame
+	if opts.Start.kind != startLive {
+		q := opts.Start.query()
+		q.metadata = opts.Metadata
+		for _, pos := range q.selectFrames(sb) {
+			f := sb.frames[sb.index(pos)]
+			f.Data = bytes.Clone(f.Data)
+			f.Metadata = f.Metadata.clone()
+			f.ref = nil
+			history = append(history, f)
+		}
+	}
+
+	sub := subscriber{
+		ch:       make(chan Frame, len(history)+size),
+		ctx:      ctx,
+		policy:   opts.Policy,
+		metadata: opts.Metadata.clone(),
+		liveFrom: sb.nextSeq,
+		done:     make(chan struct{}),
+	}
+	for _, f := range history {
+		sub.ch <- f
+	}
+
+	sb.subMu.Lock()
+	if sb.finalStopped.Load() {
+		sb.subMu.Unlock()
+		return nil, ErrStopped
+	}
+	if sb.subscribers == nil {
+		sb.subscribers = make(map[*subscriber]struct{})
+	}
+	sb.subscribers[&sub] = struct{}{}
+	sb.subscriberCount.Add(1)
+	sb.subMu.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			sb.subMu.Lock()
+			sb.unsubscribe(&sub)
+			sb.subMu.Unlock()
+		case <-sub.done:
+		}
+	}()
+
+	return sub.ch, nil
+}
+
+// publish delivers a frame to every subscriber according to its slow-subscriber policy.
+func (sb *StreamBuffer) publish(f Frame, shutdownCh <-chan struct{}) {
+	sb.subMu.Lock()
+	defer sb.subMu.Unlock()
+
+	for sub := range sb.subscribers {
+		if f.Sequence < sub.liveFrom {
+			continue // stored before subscribing
+		}
+		if !f.Metadata.Matches(sub.metadata) {
+			continue
+		}
+
+		select {
+		case sub.ch <- f:
+			continue
+		default:
+		}
+
+		switch sub.policy {
+		case SlowSubscriberDisconnect:
+			sb.subscriberDrops.Add(1)
+			sb.unsubscribe(sub)
+
+		case SlowSubscriberBlock:
+			select {
+			case sub.ch <- f:
+			case <-sub.ctx.Done():
+				sb.subscriberDrops.Add(1)
+				sb.unsubscribe(sub)
+			case <-shutdownCh:
+				sb.subscriberDrops.Add(1)
+			}
+
+		default:
+			sb.subscriberDrops.Add(1)
+		}
+	}
+}
+
+// closeSubscribers ends every subscription.
+func (sb *StreamBuffer) closeSubscribers() {
+	sb.subMu.Lock()
+	defer sb.subMu.Unlock()
+
+	for sub := range sb.subscribers {
+		sb.unsubscribe(sub)
+	}
+}
+
+// unsubscribe removes a subscriber and closes its channel. Must be called with subMu held.
+func (sb *StreamBuffer) unsubscribe(sub *subscriber) {
+	if _, ok := sb.subscribers[sub]; !ok {
+		return
+	}
+	delete(sb.subscribers, sub)
+	sb.subscriberCount.Add(-1)
+	close(sub.ch)
+	close(sub.done)
+}
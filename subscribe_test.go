@@ -0,0 +1,239 @@
+package tidstrom
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// receive reads a frame from ch or fails the test after a timeout.
+func receive(t *testing.T, ch <-chan Frame) (Frame, bool) {
+	t.Helper()
+
+	select {
+	case frame, ok := <-ch:
+		return frame, ok
+	case <-time.After(time.Second):
+		require.FailNow(t, "timed out waiting for frame")
+		return Frame{}, false
+	}
+}
+
+func TestStreamBufferSubscribe(t *testing.T) {
+	sb := NewStreamBuffer()
+	sb.Start()
+	defer sb.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	frames, err := sb.Subscribe(ctx, SubscribeOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, sb.GetMetrics().Subscribers)
+
+	for i := range 3 {
+		require.NoError(t, sb.Push(context.Background(), fmt.Appendf(nil, "Frame %d", i)))
+	}
+
+	var received []Frame
+	for range 3 {
+		frame, ok := receive(t, frames)
+		require.True(t, ok)
+		received = append(received, frame)
+	}
+
+	snapshot, err := sb.GetSnapshot(context.Background())
+	require.NoError(t, err)
+	require.Len(t, snapshot.Frames, 3)
+
+	for i, frame := range received {
+		assert.Equal(t, fmt.Sprintf("Frame %d", i), string(frame.Data))
+		assert.Equal(t, uint64(i), frame.Sequence)
+		assert.Equal(t, snapshot.Frames[i].ID, frame.ID, "live and snapshot frames should share IDs")
+		assert.Equal(t, snapshot.Frames[i].Timestamp, frame.Timestamp)
+	}
+
+	// canceling the context ends the subscription
+	cancel()
+	_, ok := receive(t, frames)
+	assert.False(t, ok, "channel should be closed after cancel")
+	assert.Equal(t, 0, sb.GetMetrics().Subscribers)
+}
+
+func TestStreamBufferSlowSubscribers(t *testing.T) {
+	t.Run("Drop", func(t *testing.T) {
+		sb := NewStreamBuffer()
+		sb.Start()
+		defer sb.Stop()
+
+		frames, err := sb.Subscribe(context.Background(), SubscribeOptions{
+			Buffer: 1,
+			Policy: SlowSubscriberDrop,
+		})
+		require.NoError(t, err)
+
+		for i := range 3 {
+			require.NoError(t, sb.Push(context.Background(), fmt.Appendf(nil, "Frame %d", i)))
+		}
+		require.Eventually(t, func() bool {
+			return sb.GetMetrics().SubscriberDrops == 2
+		}, time.Second, time.Millisecond)
+
+		frame, ok := receive(t, frames)
+		require.True(t, ok)
+		assert.Equal(t, "Frame 0", string(frame.Data))
+		assert.Equal(t, uint64(3), sb.GetMetrics().FramesProcessed, "ingestion should not stall")
+	})
+
+	t.Run("Disconnect", func(t *testing.T) {
+		sb := NewStreamBuffer()
+		sb.Start()
+		defer sb.Stop()
+
+		frames, err := sb.Subscribe(context.Background(), SubscribeOptions{
+			Buffer: 1,
+			Policy: SlowSubscriberDisconnect,
+		})
+		require.NoError(t, err)
+
+		for i := range 3 {
+			require.NoError(t, sb.Push(context.Background(), fmt.Appendf(nil, "Frame %d", i)))
+		}
+		require.Eventually(t, func() bool {
+			return sb.GetMetrics().Subscribers == 0
+		}, time.Second, time.Millisecond)
+
+		frame, ok := receive(t, frames)
+		require.True(t, ok)
+		assert.Equal(t, "Frame 0", string(frame.Data))
+
+		_, ok = receive(t, frames)
+		assert.False(t, ok, "slow subscriber should be disconnected")
+	})
+
+	t.Run("Block", func(t *testing.T) {
+		sb := NewStreamBuffer()
+		sb.Start()
+		defer sb.Stop()
+
+		frames, err := sb.Subscribe(context.Background(), SubscribeOptions{
+			Buffer: 1,
+			Policy: SlowSubscriberBlock,
+		})
+		require.NoError(t, err)
+
+		for i := range 3 {
+			require.NoError(t, sb.Push(context.Background(), fmt.Appendf(nil, "Frame %d", i)))
+		}
+
+		// the second frame waits for room, holding back the third
+		require.Eventually(t, func() bool {
+			return sb.GetMetrics().FramesProcessed == 2
+		}, time.Second, time.Millisecond)
+		time.Sleep(20 * time.Millisecond)
+		assert.Equal(t, uint64(2), sb.GetMetrics().FramesProcessed, "ingestion should wait for the subscriber")
+
+		for i := range 3 {
+			frame, ok := receive(t, frames)
+			require.True(t, ok)
+			assert.Equal(t, fmt.Sprintf("Frame %d", i), string(frame.Data))
+		}
+		assert.Equal(t, uint64(0), sb.GetMetrics().SubscriberDrops)
+	})
+}
+
+func TestStreamBufferSubscribeStop(t *testing.T) {
+	sb := NewStreamBuffer()
+	sb.Start()
+
+	frames, err := sb.Subscribe(context.Background(), SubscribeOptions{})
+	require.NoError(t, err)
+
+	sb.Stop()
+
+	_, ok := receive(t, frames)
+	assert.False(t, ok, "channel should be closed on stop")
+
+	_, err = sb.Subscribe(context.Background(), SubscribeOptions{})
+	assert.ErrorIs(t, err, ErrStopped)
+}
+
+func TestStreamBufferSubscribeReplay(t *testing.T) {
+	t.Run("From sequence", func(t *testing.T) {
+		sb, _, _ := newTestBuffer(t)
+
+		frames, err := sb.Subscribe(context.Background(), SubscribeOptions{
+			Buffer: 1,
+			Start:  StartAtSequence(7),
+		})
+		require.NoError(t, err)
+
+		require.NoError(t, sb.Push(context.Background(), []byte("Frame 10")))
+
+		for _, expected := range []string{"Frame 7", "Frame 8", "Frame 9", "Frame 10"} {
+			frame, ok := receive(t, frames)
+			require.True(t, ok)
+			assert.Equal(t, expected, string(frame.Data))
+		}
+	})
+
+	t.Run("From timestamp", func(t *testing.T) {
+		sb, _, base := newTestBuffer(t)
+
+		frames, err := sb.Subscribe(context.Background(), SubscribeOptions{
+			Start: StartAtTime(base.Add(8500 * time.Millisecond)),
+		})
+		require.NoError(t, err)
+
+		frame, ok := receive(t, frames)
+		require.True(t, ok)
+		assert.Equal(t, "Frame 9", string(frame.Data))
+
+		select {
+		case frame := <-frames:
+			assert.Fail(t, "unexpected frame", string(frame.Data))
+		default:
+		}
+	})
+
+	t.Run("Seamless handoff", func(t *testing.T) {
+		const total = 500
+
+		sb := NewStreamBuffer(WithCapacity(total), WithWindow(time.Hour))
+		sb.Start()
+		defer sb.Stop()
+
+		go func() {
+			for i := range total {
+				_ = sb.Push(context.Background(), fmt.Appendf(nil, "Frame %d", i))
+			}
+		}()
+
+		// subscribe while frames are still arriving
+		require.Eventually(t, func() bool {
+			return sb.GetMetrics().FramesProcessed >= total/4
+		}, time.Second, time.Millisecond)
+
+		frames, err := sb.Subscribe(context.Background(), SubscribeOptions{
+			Buffer: total,
+			Start:  StartAtSequence(0),
+		})
+		require.NoError(t, err)
+
+		for i := range total {
+			frame, ok := receive(t, frames)
+			require.True(t, ok)
+			require.Equal(t, uint64(i), frame.Sequence, "frames should arrive without gaps or duplicates")
+		}
+
+		select {
+		case frame := <-frames:
+			assert.Fail(t, "unexpected duplicate frame", "sequence %d", frame.Sequence)
+		case <-time.After(20 * time.Millisecond):
+		}
+	})
+}
@@ -0,0 +1,185 @@
+package tidstrom
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Names of the columns every tabular export starts with.
+const (
+	timestampColumn = "timestamp"
+	sequenceColumn  = "sequence"
+)
+
+// ColumnType is the type of a column decoded from frame data.
+type ColumnType int
+
+const (
+	// ColumnInt64 holds signed integers, given as any Go integer type that fits in an int64.
+	ColumnInt64 ColumnType = iota
+	// ColumnFloat64 holds floating-point numbers, given as float32 or float64.
+	ColumnFloat64
+	// ColumnString holds text, given as a string or []byte.
+	ColumnString
+	// ColumnBool holds booleans.
+	ColumnBool
+)
+
+// String returns the name of the column type.
+func (t ColumnType) String() string {
+	switch t {
+	case ColumnInt64:
+		return "int64"
+	case ColumnFloat64:
+		return "float64"
+	case ColumnString:
+		return "string"
+	case ColumnBool:
+		return "bool"
+	}
+	return "ColumnType(" + strconv.Itoa(int(t)) + ")"
+}
+
+// Column describes a column decoded from frame data.
+type Column struct {
+	Name string
+	Type ColumnType
+}
+
+// RowDecoder decodes a frame's data into a row of values, one for each
+// column in order. A nil value is a null.
+type RowDecoder func(data []byte) ([]any, error)
+
+// validateColumns reports whether columns can be exported alongside the
+// timestamp and sequence columns.
+func validateColumns(columns []Column) error {
+	seen := map[string]bool{timestampColumn: true, sequenceColumn: true}
+	for _, c := range columns {
+		if seen[c.Name] {
+			return fmt.Errorf("duplicate column %q", c.Name)
+		}
+		seen[c.Name] = true
+		if c.Type < ColumnInt64 || c.Type > ColumnBool {
+			return fmt.Errorf("column %q: unknown type %d", c.Name, c.Type)
+		}
+	}
+	return nil
+}
+
+// decodeRow decodes a frame's data into values of its columns' Go types:
+// int64, float64, string or bool, or nil for a null.
+func decodeRow(f *Frame, columns []Column, decode RowDecoder) ([]any, error) {
+	row, err := decode(f.Data)
+	if err != nil {
+		return nil, fmt.Errorf("frame %d: %w", f.Sequence, err)
+	}
+	if len(row) != len(columns) {
+		return nil, fmt.Errorf("frame %d: decoded %d values for %d columns", f.Sequence, len(row), len(columns))
+	}
+	for i, v := range row {
+		if v == nil {
+			continue
+		}
+		if row[i], err = columnValue(columns[i].Type, v); err != nil {
+			return nil, fmt.Errorf("frame %d: column %q: %w", f.Sequence, columns[i].Name, err)
+		}
+	}
+	return row, nil
+}
+
+// columnValue converts v to the Go type of a column of type t.
+func columnValue(t ColumnType, v any) (any, error) {
+	switch t {
+	case ColumnInt64:
+		switch n := v.(type) {
+		case int:
+			return int64(n), nil
+		case int8:
+			return int64(n), nil
+		case int16:
+			return int64(n), nil
+		case int32:
+			return int64(n), nil
+		case int64:
+			return n, nil
+		case uint8:
+			return int64(n), nil
+		case uint16:
+			return int64(n), nil
+		case uint32:
+			return int64(n), nil
+		}
+	case ColumnFloat64:
+		switch n := v.(type) {
+		case float32:
+			return float64(n), nil
+		case float64:
+			return n, nil
+		}
+	case ColumnString:
+		switch s := v.(type) {
+		case string:
+			return s, nil
+		case []byte:
+			return string(s), nil
+		}
+	case ColumnBool:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("%T is not a %s value", v, t)
+}
+
+// WriteCSV writes the snapshot's frames to w as CSV with a header row. Each
+// frame's data is decoded into the given columns, which follow a timestamp
+// column (RFC 3339, UTC) and a sequence column. Nulls are written as empty fields.
+func (s *Snapshot) WriteCSV(w io.Writer, columns []Column, decode RowDecoder) error {
+	if err := validateColumns(columns); err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	record := make([]string, 2+len(columns))
+	record[0], record[1] = timestampColumn, sequenceColumn
+	for i, c := range columns {
+		record[2+i] = c.Name
+	}
+	if err := cw.Write(record); err != nil {
+		return err
+	}
+
+	for i := range s.Frames {
+		f := &s.Frames[i]
+		row, err := decodeRow(f, columns, decode)
+		if err != nil {
+			return err
+		}
+
+		record[0] = f.Timestamp.UTC().Format(time.RFC3339Nano)
+		record[1] = strconv.FormatUint(f.Sequence, 10)
+		for i, v := range row {
+			switch v := v.(type) {
+			case nil:
+				record[2+i] = ""
+			case int64:
+				record[2+i] = strconv.FormatInt(v, 10)
+			case float64:
+				record[2+i] = strconv.FormatFloat(v, 'g', -1, 64)
+			case string:
+				record[2+i] = v
+			case bool:
+				record[2+i] = strconv.FormatBool(v)
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
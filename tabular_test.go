@@ -0,0 +1,84 @@
+package tidstrom
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sensorColumns are the columns decoded by decodeSensor.
+var sensorColumns = []Column{
+	{Name: "sensor", Type: ColumnString},
+	{Name: "temperature", Type: ColumnFloat64},
+	{Name: "alarm", Type: ColumnBool},
+	{Name: "reading", Type: ColumnInt64},
+}
+
+// decodeSensor decodes "sensor,temperature,alarm,reading" records, with an
+// empty temperature as a null.
+func decodeSensor(data []byte) ([]any, error) {
+	parts := strings.Split(string(data), ",")
+	if len(parts) != 4 {
+		return nil, errors.New("malformed record")
+	}
+
+	var temperature any
+	if parts[1] != "" {
+		t, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return nil, err
+		}
+		temperature = t
+	}
+	reading, err := strconv.Atoi(parts[3])
+	if err != nil {
+		return nil, err
+	}
+	return []any{parts[0], temperature, parts[2] == "true", reading}, nil
+}
+
+// sensorRecords are three records in the form decodeSensor reads.
+var sensorRecords = [][]byte{[]byte("t1,21.5,false,7"), []byte("t2,,true,8"), []byte(`t"3",-0.25,false,9`)}
+
+func TestSnapshotWriteCSV(t *testing.T) {
+	t.Run("rows", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, testSnapshot(time.Second, sensorRecords...).WriteCSV(&buf, sensorColumns, decodeSensor))
+
+		want := "timestamp,sequence,sensor,temperature,alarm,reading\n" +
+			"2024-01-01T12:00:00Z,10,t1,21.5,false,7\n" +
+			"2024-01-01T12:00:01Z,11,t2,,true,8\n" +
+			"2024-01-01T12:00:02Z,12,\"t\"\"3\"\"\",-0.25,false,9\n"
+		assert.Equal(t, want, buf.String())
+	})
+
+	t.Run("invalid columns", func(t *testing.T) {
+		snapshot := testSnapshot(time.Second, sensorRecords...)
+		err := snapshot.WriteCSV(&bytes.Buffer{}, []Column{{Name: "sequence", Type: ColumnInt64}}, decodeSensor)
+		assert.ErrorContains(t, err, "duplicate column")
+
+		err = snapshot.WriteCSV(&bytes.Buffer{}, []Column{{Name: "x", Type: ColumnType(9)}}, decodeSensor)
+		assert.ErrorContains(t, err, "unknown type")
+	})
+
+	t.Run("decoder errors", func(t *testing.T) {
+		snapshot := testSnapshot(time.Second, sensorRecords...)
+		snapshot.Frames[1].Data = []byte("garbage")
+		err := snapshot.WriteCSV(&bytes.Buffer{}, sensorColumns, decodeSensor)
+		assert.ErrorContains(t, err, "frame 11: malformed record")
+
+		wrongType := func([]byte) ([]any, error) { return []any{"t1", "hot", false, 1}, nil }
+		err = testSnapshot(time.Second, sensorRecords...).WriteCSV(&bytes.Buffer{}, sensorColumns, wrongType)
+		assert.ErrorContains(t, err, `column "temperature": string is not a float64 value`)
+
+		tooFew := func([]byte) ([]any, error) { return []any{"t1"}, nil }
+		err = testSnapshot(time.Second, sensorRecords...).WriteCSV(&bytes.Buffer{}, sensorColumns, tooFew)
+		assert.ErrorContains(t, err, "decoded 1 values for 4 columns")
+	})
+}
@@ -0,0 +1,67 @@
+package tidstromtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClock(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := NewClock(start)
+	assert.Equal(t, start, c.Now(), "should start at the given time")
+
+	c.Advance(1500 * time.Millisecond)
+	assert.Equal(t, start.Add(1500*time.Millisecond), c.Now(), "should advance by the given duration")
+
+	later := start.Add(time.Hour)
+	c.Set(later)
+	assert.Equal(t, later, c.Now(), "should move to the given time")
+}
+
+func TestClockAfter(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := NewClock(start)
+
+	immediate := c.After(0)
+	short := c.After(time.Second)
+	long := c.After(time.Minute)
+	assert.Equal(t, 2, c.Waiters(), "should have two pending waiters")
+
+	select {
+	case tick := <-immediate:
+		assert.Equal(t, start, tick, "non-positive durations should fire immediately")
+	default:
+		require.Fail(t, "immediate waiter should have fired")
+	}
+
+	c.Advance(999 * time.Millisecond)
+	select {
+	case <-short:
+		require.Fail(t, "waiter should not fire before its deadline")
+	default:
+	}
+
+	c.Advance(time.Millisecond)
+	select {
+	case tick := <-short:
+		assert.Equal(t, start.Add(time.Second), tick, "should deliver the clock time")
+	default:
+		require.Fail(t, "waiter should fire at its deadline")
+	}
+	assert.Equal(t, 1, c.Waiters(), "should have one pending waiter")
+
+	c.Set(start.Add(time.Hour))
+	select {
+	case <-long:
+	default:
+		require.Fail(t, "Set should fire due waiters")
+	}
+	assert.Equal(t, 0, c.Waiters(), "should have no pending waiters")
+}
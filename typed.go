@@ -0,0 +1,215 @@
+package tidstrom
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+// TypedFrame is a frame carrying a value of type T instead of bytes.
+type TypedFrame[T any] struct {
+	ID        string    `json:"id"`
+	Value     T         `json:"value"`              // frame payload
+	Timestamp time.Time `json:"timestamp"`          // capture time
+	Sequence  uint64    `json:"sequence"`           // unique monotonic ID
+	Metadata  Metadata  `json:"metadata,omitempty"` // optional frame attributes
+}
+
+// TypedSnapshot contains a point-in-time copy of frames within a TypedBuffer.
+type TypedSnapshot[T any] struct {
+	ID        string          `json:"id"`
+	Frames    []TypedFrame[T] `json:"frames"`     // ordered collection of frames
+	StartTime time.Time       `json:"start_time"` // timestamp of oldest frame
+	EndTime   time.Time       `json:"end_time"`   // timestamp of newest frame
+	Timestamp time.Time       `json:"timestamp"`  // when snapshot was created
+}
+
+// TypedBuffer is a StreamBuffer for values of type T, sharing its windowing,
+// ordering, trimming and query behavior without serializing values to bytes.
+type TypedBuffer[T any] struct {
+	sb    *StreamBuffer
+	clone func(T) T
+}
+
+// NewTypedBuffer creates a new TypedBuffer with the specified options.
+// Values are copied with clone when pushed and again for each snapshot, so
+// neither producers nor consumers share them with the buffer. A nil clone
+// copies by assignment, which suits value types. Options that limit frame
+// data size, such as WithMaxBytes, have no effect on typed values, and as
+// values are not serialized, WithSpill and WithWAL are ignored.
+// The returned TypedBuffer is not started; call Start() to begin processing.
+func NewTypedBuffer[T any](clone func(T) T, opts ...StreamBufferOption) *TypedBuffer[T] {
+	if clone == nil {
+		clone = func(v T) T { return v }
+	}
+	return &TypedBuffer[T]{
+		sb:    NewStreamBuffer(append(slices.Clone(opts), withoutStore())...),
+		clone: clone,
+	}
+}
+
+// withoutStore detaches any segment store set by earlier options.
+func withoutStore() StreamBufferOption {
+	return func(sb *StreamBuffer) {
+		sb.store = nil
+		sb.recoverFrames = false
+	}
+}
+
+// Start begins processing incoming values in a background goroutine.
+func (tb *TypedBuffer[T]) Start() {
+	tb.sb.Start()
+}
+
+// Stop halts processing. Once stopped, the buffer cannot be restarted.
+func (tb *TypedBuffer[T]) Stop() {
+	tb.sb.Stop()
+}
+
+// IsRunning returns whether the TypedBuffer is currently running.
+func (tb *TypedBuffer[T]) IsRunning() bool {
+	return tb.sb.IsRunning()
+}
+
+// GetMetrics returns current performance statistics.
+func (tb *TypedBuffer[T]) GetMetrics() Metrics {
+	return tb.sb.GetMetrics()
+}
+
+// Push queues a value stamped when it is processed. See StreamBuffer.Push.
+func (tb *TypedBuffer[T]) Push(ctx context.Context, v T) error {
+	return tb.PushFrame(ctx, TypedFrame[T]{Value: v})
+}
+
+// PushFrame queues a value with its capture timestamp. See StreamBuffer.PushFrame.
+func (tb *TypedBuffer[T]) PushFrame(ctx context.Context, f TypedFrame[T]) error {
+	return tb.sb.PushFrame(ctx, tb.toFrame(f))
+}
+
+// TryPush queues a value without blocking. See StreamBuffer.TryPush.
+func (tb *TypedBuffer[T]) TryPush(v T) bool {
+	return tb.TryPushFrame(TypedFrame[T]{Value: v})
+}
+
+// TryPushFrame queues a value with its capture timestamp without blocking.
+// See StreamBuffer.TryPushFrame.
+func (tb *TypedBuffer[T]) TryPushFrame(f TypedFrame[T]) bool {
+	return tb.sb.TryPushFrame(tb.toFrame(f))
+}
+
+// GetSnapshot returns a point-in-time copy of the buffer contents.
+func (tb *TypedBuffer[T]) GetSnapshot(ctx context.Context) (*TypedSnapshot[T], error) {
+	snapshot, err := tb.sb.GetSnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return tb.toSnapshot(snapshot), nil
+}
+
+// GetRange returns a copy of the values with timestamps between from and to, inclusive.
+// See StreamBuffer.GetRange.
+func (tb *TypedBuffer[T]) GetRange(ctx context.Context, from, to time.Time) (*TypedSnapshot[T], error) {
+	snapshot, err := tb.sb.GetRange(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return tb.toSnapshot(snapshot), nil
+}
+
+// GetMatching returns a copy of the values whose metadata contains every
+// key/value pair in want. See StreamBuffer.GetMatching.
+func (tb *TypedBuffer[T]) GetMatching(ctx context.Context, want Metadata) (*TypedSnapshot[T], error) {
+	snapshot, err := tb.sb.GetMatching(ctx, want)
+	if err != nil {
+		return nil, err
+	}
+	return tb.toSnapshot(snapshot), nil
+}
+
+// GetSince returns a copy of the values with a Sequence of seq or higher and
+// reports whether some of them were evicted. See StreamBuffer.GetSince.
+func (tb *TypedBuffer[T]) GetSince(ctx context.Context, seq uint64) (*TypedSnapshot[T], bool, error) {
+	snapshot, gap, err := tb.sb.GetSince(ctx, seq)
+	if err != nil {
+		return nil, false, err
+	}
+	return tb.toSnapshot(snapshot), gap, nil
+}
+
+// GetLast returns a copy of the newest n values.
+func (tb *TypedBuffer[T]) GetLast(ctx context.Context, n int) (*TypedSnapshot[T], error) {
+	snapshot, err := tb.sb.GetLast(ctx, n)
+	if err != nil {
+		return nil, err
+	}
+	return tb.toSnapshot(snapshot), nil
+}
+
+// Subscribe returns a channel that receives each value as it is stored.
+// See StreamBuffer.Subscribe.
+func (tb *TypedBuffer[T]) Subscribe(ctx context.Context, opts SubscribeOptions) (<-chan TypedFrame[T], error) {
+	frames, err := tb.sb.Subscribe(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan TypedFrame[T])
+	go func() {
+		defer close(out)
+		for f := range frames {
+			select {
+			case out <- tb.fromFrame(f):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// toFrame wraps a typed frame for the underlying buffer.
+func (tb *TypedBuffer[T]) toFrame(f TypedFrame[T]) Frame {
+	return Frame{
+		ID:        f.ID,
+		Timestamp: f.Timestamp,
+		Metadata:  f.Metadata,
+		value:     typedValue[T]{v: tb.clone(f.Value)},
+	}
+}
+
+// fromFrame unwraps a frame from the underlying buffer, cloning its value.
+func (tb *TypedBuffer[T]) fromFrame(f Frame) TypedFrame[T] {
+	tf := TypedFrame[T]{
+		ID:        f.ID,
+		Timestamp: f.Timestamp,
+		Sequence:  f.Sequence,
+		Metadata:  f.Metadata,
+	}
+	if v, ok := f.value.(typedValue[T]); ok {
+		tf.Value = tb.clone(v.v)
+	}
+	return tf
+}
+
+// toSnapshot converts and releases a snapshot of the underlying buffer.
+func (tb *TypedBuffer[T]) toSnapshot(s *Snapshot) *TypedSnapshot[T] {
+	defer s.Release()
+
+	frames := make([]TypedFrame[T], len(s.Frames))
+	for i, f := range s.Frames {
+		frames[i] = tb.fromFrame(f)
+	}
+	return &TypedSnapshot[T]{
+		ID:        s.ID,
+		Frames:    frames,
+		StartTime: s.StartTime,
+		EndTime:   s.EndTime,
+		Timestamp: s.Timestamp,
+	}
+}
+
+// typedValue boxes a payload so that a nil interface or pointer value is
+// still distinguishable from a frame without a payload.
+type typedValue[T any] struct {
+	v T
+}
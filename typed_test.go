@@ -0,0 +1,147 @@
+package tidstrom
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alesr/tidstrom/tidstromtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reading is a sample sensor payload with a reference field.
+type reading struct {
+	Sensor string
+	Values []float64
+}
+
+func cloneReading(r reading) reading {
+	r.Values = slices.Clone(r.Values)
+	return r
+}
+
+func TestTypedBuffer(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tb := NewTypedBuffer(cloneReading,
+		WithWindow(2*time.Second),
+		WithClock(tidstromtest.NewClock(base.Add(3*time.Second))),
+	)
+	tb.Start()
+	defer tb.Stop()
+
+	values := []float64{1, 2, 3}
+	for i := range 4 {
+		require.NoError(t, tb.PushFrame(context.Background(), TypedFrame[reading]{
+			Value:     reading{Sensor: "temp", Values: values},
+			Timestamp: base.Add(time.Duration(i) * time.Second),
+		}))
+	}
+	require.Eventually(t, func() bool {
+		return tb.GetMetrics().FramesProcessed == 4
+	}, time.Second, time.Millisecond)
+
+	// the buffer holds its own copies
+	values[0] = 100
+
+	snapshot, err := tb.GetSnapshot(context.Background())
+	require.NoError(t, err)
+
+	require.Len(t, snapshot.Frames, 3, "values outside the window should be trimmed")
+	for i, frame := range snapshot.Frames {
+		assert.Equal(t, reading{Sensor: "temp", Values: []float64{1, 2, 3}}, frame.Value)
+		assert.Equal(t, base.Add(time.Duration(i+1)*time.Second), frame.Timestamp)
+		assert.Equal(t, uint64(i+1), frame.Sequence)
+		assert.NotEmpty(t, frame.ID)
+	}
+	assert.Equal(t, base.Add(time.Second), snapshot.StartTime)
+	assert.Equal(t, base.Add(3*time.Second), snapshot.EndTime)
+
+	// each snapshot gets its own copies
+	snapshot.Frames[0].Value.Values[0] = 200
+	again, err := tb.GetLast(context.Background(), 3)
+	require.NoError(t, err)
+	assert.Equal(t, []float64{1, 2, 3}, again.Frames[0].Value.Values)
+
+	ranged, err := tb.GetRange(context.Background(), base.Add(2*time.Second), base.Add(2*time.Second))
+	require.NoError(t, err)
+	require.Len(t, ranged.Frames, 1)
+	assert.Equal(t, uint64(2), ranged.Frames[0].Sequence)
+
+	since, gap, err := tb.GetSince(context.Background(), 0)
+	require.NoError(t, err)
+	assert.True(t, gap, "the first value was trimmed")
+	assert.Len(t, since.Frames, 3)
+}
+
+func TestTypedBufferValueTypes(t *testing.T) {
+	tb := NewTypedBuffer[int](nil, WithZeroCopySnapshots())
+	tb.Start()
+	defer tb.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	live, err := tb.Subscribe(ctx, SubscribeOptions{})
+	require.NoError(t, err)
+
+	for i := range 3 {
+		assert.True(t, tb.TryPush(i*10))
+	}
+
+	for i := range 3 {
+		select {
+		case frame := <-live:
+			assert.Equal(t, i*10, frame.Value)
+		case <-time.After(time.Second):
+			require.FailNow(t, "timed out waiting for value")
+		}
+	}
+
+	snapshot, err := tb.GetSnapshot(context.Background())
+	require.NoError(t, err)
+
+	var got []int
+	for _, frame := range snapshot.Frames {
+		got = append(got, frame.Value)
+	}
+	assert.Equal(t, []int{0, 10, 20}, got, "zero values should be stored like any other")
+	assert.Equal(t, 0, tb.GetMetrics().BytesStored, "typed values should not use frame data")
+
+	tb.Stop()
+	assert.False(t, tb.IsRunning())
+	assert.ErrorIs(t, tb.Push(context.Background(), 30), ErrStopped)
+}
+
+func TestTypedBufferIgnoresStore(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	dir, _ := writeWAL(t, base)
+
+	store, err := OpenSegmentStore(dir)
+	require.NoError(t, err)
+	defer store.Close()
+
+	tb := NewTypedBuffer[int](nil,
+		WithWindow(5*time.Second),
+		WithClock(tidstromtest.NewClock(base.Add(10*time.Second))),
+		WithWAL(store),
+	)
+	tb.Start()
+	defer tb.Stop()
+
+	require.True(t, tb.TryPush(42))
+	require.Eventually(t, func() bool {
+		return tb.GetMetrics().FramesProcessed == 1
+	}, time.Second, time.Millisecond)
+
+	metrics := tb.GetMetrics()
+	assert.Zero(t, metrics.FramesRecovered, "logged byte frames should not be restored as values")
+	assert.Zero(t, metrics.FramesSpilled)
+
+	snapshot, err := tb.GetSnapshot(context.Background())
+	require.NoError(t, err)
+	require.Len(t, snapshot.Frames, 1)
+	assert.Equal(t, 42, snapshot.Frames[0].Value)
+	assert.Equal(t, uint64(0), snapshot.Frames[0].Sequence)
+}
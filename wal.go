@@ -0,0 +1,41 @@
+package tidstrom
+
+import "time"
+
+// recover restores the frames within the window from the write-ahead log,
+// as many of the newest as fit within the capacity and byte budget.
+func (sb *StreamBuffer) recover() {
+	entries := sb.store.entries(sb.clock.Now().Add(-sb.window), time.Time{})
+
+	// keep the newest entries that fit, always at least one
+	first, size := len(entries), 0
+	for first > 0 && len(entries)-first < sb.capacity {
+		size += entries[first-1].size
+		if sb.maxBytes > 0 && size > sb.maxBytes && first < len(entries) {
+			break
+		}
+		first--
+	}
+
+	for i := first; i < len(entries); i++ {
+		e := &entries[i]
+		data, err := sb.store.read(sb.newFrameBuffer(e.size), e)
+		if err != nil {
+			sb.spillErrors.Add(1)
+			continue
+		}
+
+		f := e.frame()
+		f.Data = data
+		f.ref = newFrameRef(data, sb.bufferPool)
+
+		sb.frames[sb.head] = f
+		sb.head = (sb.head + 1) % sb.capacity
+		sb.count++
+		sb.bytes += cap(data)
+		sb.lastFrameTime = f.Timestamp
+	}
+	// frames were recovered by clock time, so the stream time continues from it
+	sb.lastFrameAt = sb.lastFrameTime
+	sb.framesRecovered.Store(uint64(sb.count))
+}
@@ -0,0 +1,96 @@
+package tidstrom
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alesr/tidstrom/tidstromtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeWAL logs ten frames captured one second apart to a new directory and
+// returns it with a snapshot of the frames within a five-second window of the
+// newest one. The store is closed without stopping the buffer first, as in a crash.
+func writeWAL(t *testing.T, base time.Time) (string, *Snapshot) {
+	t.Helper()
+
+	dir := t.TempDir()
+	store, err := OpenSegmentStore(dir, WithSyncWrites())
+	require.NoError(t, err)
+
+	sb := NewStreamBuffer(
+		WithWindow(5*time.Second),
+		WithClock(tidstromtest.NewClock(base.Add(10*time.Second))),
+		WithWAL(store),
+	)
+	sb.Start()
+	pushGOPs(t, sb, base, 0, 10, 0, 5)
+
+	snapshot, err := sb.GetSnapshot(context.Background())
+	require.NoError(t, err)
+	require.Len(t, snapshot.Frames, 6)
+
+	require.NoError(t, store.Close())
+	sb.Stop()
+	return dir, snapshot
+}
+
+func TestStreamBufferWALRecovery(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	testCases := []struct {
+		name     string
+		opts     []StreamBufferOption
+		restored int
+	}{
+		{name: "Whole window", restored: 3},
+		{name: "Capacity", opts: []StreamBufferOption{WithCapacity(2)}, restored: 2},
+		{name: "Byte budget", opts: []StreamBufferOption{WithMaxBytes(20)}, restored: 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, before := writeWAL(t, base)
+
+			store, err := OpenSegmentStore(dir)
+			require.NoError(t, err)
+			defer store.Close()
+
+			// restarting two seconds later, frames 0-6 are outside the window
+			restarted := NewStreamBuffer(append([]StreamBufferOption{
+				WithWindow(5 * time.Second),
+				WithClock(tidstromtest.NewClock(base.Add(12 * time.Second))),
+				WithWAL(store),
+			}, tc.opts...)...)
+			restarted.Start()
+			defer restarted.Stop()
+
+			metrics := restarted.GetMetrics()
+			assert.Equal(t, uint64(tc.restored), metrics.FramesRecovered)
+			assert.Equal(t, tc.restored, metrics.FrameCount)
+			assert.True(t, base.Add(9*time.Second).Equal(metrics.LastFrameTime))
+
+			after, err := restarted.GetSnapshot(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"Frame 7", "Frame 8", "Frame 9"}, frameData(after.Frames),
+				"frames that did not fit in memory should be read from disk")
+			for i, frame := range after.Frames {
+				original := before.Frames[i+3]
+				assert.Equal(t, original.ID, frame.ID)
+				assert.Equal(t, original.Sequence, frame.Sequence)
+				assert.True(t, original.Timestamp.Equal(frame.Timestamp))
+			}
+
+			live, err := restarted.Subscribe(ctx, SubscribeOptions{})
+			require.NoError(t, err)
+			require.True(t, restarted.TryPush([]byte("after restart")))
+
+			frame, ok := receive(t, live)
+			require.True(t, ok)
+			assert.Equal(t, uint64(10), frame.Sequence, "sequences should continue after the recovered ones")
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package tidstrom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// defaultGapTolerance is the default shortest timestamp gap filled with silence.
+const defaultGapTolerance = 10 * time.Millisecond
+
+// AudioFormat describes the PCM audio carried by frames: interleaved samples,
+// little-endian, unsigned for 8 bits per sample and signed otherwise.
+type AudioFormat struct {
+	SampleRate    int // samples per second per channel
+	Channels      int
+	BitsPerSample int // 8, 16, 24 or 32
+
+	// GapTolerance is the shortest difference between a frame's timestamp and
+	// the end of the audio before it that is treated as lost audio and filled
+	// with silence, so that capture jitter is ignored. Defaults to 10ms.
+	GapTolerance time.Duration
+}
+
+// blockAlign returns the size in bytes of one sample for every channel.
+func (f AudioFormat) blockAlign() int {
+	return f.Channels * f.BitsPerSample / 8
+}
+
+// validate reports whether the format can be written as PCM WAV.
+func (f AudioFormat) validate() error {
+	switch {
+	case f.SampleRate <= 0:
+		return errors.New("sample rate must be positive")
+	case f.Channels <= 0:
+		return errors.New("channel count must be positive")
+	case f.BitsPerSample != 8 && f.BitsPerSample != 16 && f.BitsPerSample != 24 && f.BitsPerSample != 32:
+		return fmt.Errorf("unsupported bits per sample %d", f.BitsPerSample)
+	}
+	return nil
+}
+
+// WriteWAV writes the snapshot's frames, each a chunk of PCM audio whose
+// Timestamp is the capture time of its first sample, to w as a WAV file.
+// Where a frame starts later than the audio before it ends, the gap is filled
+// with silence, so the audio stays aligned with the frame timestamps and
+// spans EndTime - StartTime plus the duration of the last frame.
+func (s *Snapshot) WriteWAV(w io.Writer, format AudioFormat) error {
+	if err := format.validate(); err != nil {
+		return err
+	}
+	tolerance := format.GapTolerance
+	if tolerance <= 0 {
+		tolerance = defaultGapTolerance
+	}
+	align := format.blockAlign()
+
+	// plan the silence before each frame to know the data size up front
+	gaps := make([]int, len(s.Frames)) // samples of silence before each frame
+	var samples int64
+	for i, f := range s.Frames {
+		if len(f.Data)%align != 0 {
+			return fmt.Errorf("frame %d: %d bytes is not a whole number of %d-byte samples", f.Sequence, len(f.Data), align)
+		}
+		if i > 0 {
+			offset := f.Timestamp.Sub(s.Frames[0].Timestamp)
+			expected := int64(offset.Seconds() * float64(format.SampleRate))
+			end := time.Duration(float64(samples) / float64(format.SampleRate) * float64(time.Second))
+			if offset-end >= tolerance && expected > samples {
+				gaps[i] = int(expected - samples)
+				samples = expected
+			}
+		}
+		samples += int64(len(f.Data) / align)
+	}
+
+	// RIFF chunks are word-aligned, so odd-sized data is followed by a pad byte
+	dataSize := samples * int64(align)
+	pad := dataSize % 2
+	if dataSize+pad > 0xFFFFFFFF-36 {
+		return errors.New("audio too long for a WAV file")
+	}
+
+	header := make([]byte, 0, 44)
+	header = append(header, "RIFF"...)
+	header = binary.LittleEndian.AppendUint32(header, uint32(36+dataSize+pad))
+	header = append(header, "WAVEfmt "...)
+	header = binary.LittleEndian.AppendUint32(header, 16) // fmt chunk size
+	header = binary.LittleEndian.AppendUint16(header, 1)  // PCM
+	header = binary.LittleEndian.AppendUint16(header, uint16(format.Channels))
+	header = binary.LittleEndian.AppendUint32(header, uint32(format.SampleRate))
+	header = binary.LittleEndian.AppendUint32(header, uint32(format.SampleRate*align)) // bytes per second
+	header = binary.LittleEndian.AppendUint16(header, uint16(align))
+	header = binary.LittleEndian.AppendUint16(header, uint16(format.BitsPerSample))
+	header = append(header, "data"...)
+	header = binary.LittleEndian.AppendUint32(header, uint32(dataSize))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	// unsigned 8-bit audio is silent at its midpoint
+	var silenceByte byte
+	if format.BitsPerSample == 8 {
+		silenceByte = 0x80
+	}
+	var silence []byte
+
+	for i, f := range s.Frames {
+		for remaining := gaps[i] * align; remaining > 0; {
+			if silence == nil {
+				silence = bytes.Repeat([]byte{silenceByte}, 4096*align)
+			}
+			n := min(remaining, len(silence))
+			if _, err := w.Write(silence[:n]); err != nil {
+				return err
+			}
+			remaining -= n
+		}
+		if _, err := w.Write(f.Data); err != nil {
+			return err
+		}
+	}
+	if pad == 1 {
+		_, err := w.Write([]byte{0})
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package tidstrom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pcmFrame returns a 16-bit mono frame of ten samples set to value.
+func pcmFrame(value uint16) []byte {
+	var data []byte
+	for range 10 {
+		data = binary.LittleEndian.AppendUint16(data, value)
+	}
+	return data
+}
+
+// pcmSamples returns the 16-bit samples of a WAV file's data chunk.
+func pcmSamples(t *testing.T, wav []byte) []uint16 {
+	t.Helper()
+	require.GreaterOrEqual(t, len(wav), 44)
+	assert.Equal(t, "data", string(wav[36:40]))
+	data := wav[44:]
+	require.Equal(t, int(binary.LittleEndian.Uint32(wav[40:])), len(data))
+
+	samples := make([]uint16, len(data)/2)
+	for i := range samples {
+		samples[i] = binary.LittleEndian.Uint16(data[2*i:])
+	}
+	return samples
+}
+
+func TestSnapshotWriteWAV(t *testing.T) {
+	format := AudioFormat{SampleRate: 1000, Channels: 1, BitsPerSample: 16}
+
+	t.Run("header", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, testSnapshot(10*time.Millisecond, pcmFrame(1), pcmFrame(2)).WriteWAV(&buf, format))
+		wav := buf.Bytes()
+
+		assert.Equal(t, "RIFF", string(wav[:4]))
+		assert.Equal(t, uint32(len(wav)-8), binary.LittleEndian.Uint32(wav[4:]))
+		assert.Equal(t, "WAVEfmt ", string(wav[8:16]))
+		assert.Equal(t, uint32(16), binary.LittleEndian.Uint32(wav[16:]))
+		assert.Equal(t, uint16(1), binary.LittleEndian.Uint16(wav[20:]), "PCM")
+		assert.Equal(t, uint16(1), binary.LittleEndian.Uint16(wav[22:]), "channels")
+		assert.Equal(t, uint32(1000), binary.LittleEndian.Uint32(wav[24:]), "sample rate")
+		assert.Equal(t, uint32(2000), binary.LittleEndian.Uint32(wav[28:]), "byte rate")
+		assert.Equal(t, uint16(2), binary.LittleEndian.Uint16(wav[32:]), "block align")
+		assert.Equal(t, uint16(16), binary.LittleEndian.Uint16(wav[34:]), "bits per sample")
+		assert.Len(t, pcmSamples(t, wav), 20)
+	})
+
+	t.Run("gaps are filled with silence", func(t *testing.T) {
+		snapshot := testSnapshot(10*time.Millisecond, pcmFrame(1), pcmFrame(2), pcmFrame(3), pcmFrame(4))
+		// the last two frames follow a 30ms gap
+		for i := 2; i < 4; i++ {
+			snapshot.Frames[i].Timestamp = snapshot.Frames[i].Timestamp.Add(30 * time.Millisecond)
+		}
+		snapshot.EndTime = snapshot.Frames[3].Timestamp
+
+		var buf bytes.Buffer
+		require.NoError(t, snapshot.WriteWAV(&buf, format))
+		samples := pcmSamples(t, buf.Bytes())
+
+		// 60ms between the first and last frame, plus the last frame's 10ms
+		span := snapshot.EndTime.Sub(snapshot.StartTime) + 10*time.Millisecond
+		require.Len(t, samples, int(span.Milliseconds()))
+		assert.Equal(t, uint16(2), samples[19])
+		assert.Equal(t, make([]uint16, 30), samples[20:50], "silence for the 30ms gap")
+		assert.Equal(t, uint16(3), samples[50])
+		assert.Equal(t, uint16(4), samples[69])
+	})
+
+	t.Run("jitter within tolerance is ignored", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, testSnapshot(15*time.Millisecond, pcmFrame(1), pcmFrame(2)).WriteWAV(&buf, format))
+		assert.Len(t, pcmSamples(t, buf.Bytes()), 20)
+
+		buf.Reset()
+		strict := format
+		strict.GapTolerance = time.Millisecond
+		require.NoError(t, testSnapshot(15*time.Millisecond, pcmFrame(1), pcmFrame(2)).WriteWAV(&buf, strict))
+		assert.Len(t, pcmSamples(t, buf.Bytes()), 25)
+	})
+
+	t.Run("8-bit silence", func(t *testing.T) {
+		snapshot := testSnapshot(20*time.Millisecond, bytes.Repeat([]byte{0xFF}, 20), bytes.Repeat([]byte{0xFF}, 20))
+
+		var buf bytes.Buffer
+		stereo := AudioFormat{SampleRate: 1000, Channels: 2, BitsPerSample: 8}
+		require.NoError(t, snapshot.WriteWAV(&buf, stereo))
+		data := buf.Bytes()[44:]
+		require.Len(t, data, 60)
+		assert.Equal(t, bytes.Repeat([]byte{0x80}, 20), data[20:40])
+	})
+
+	t.Run("odd data size is padded", func(t *testing.T) {
+		snapshot := &Snapshot{Frames: []Frame{{Data: []byte{1, 2, 3}}}}
+
+		var buf bytes.Buffer
+		mono := AudioFormat{SampleRate: 8000, Channels: 1, BitsPerSample: 8}
+		require.NoError(t, snapshot.WriteWAV(&buf, mono))
+		wav := buf.Bytes()
+
+		require.Len(t, wav, 44+4)
+		assert.Equal(t, uint32(len(wav)-8), binary.LittleEndian.Uint32(wav[4:]), "RIFF size should include the pad byte")
+		assert.Equal(t, uint32(3), binary.LittleEndian.Uint32(wav[40:]), "data size should exclude the pad byte")
+		assert.Equal(t, []byte{1, 2, 3, 0}, wav[44:])
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		snapshot := testSnapshot(10*time.Millisecond, pcmFrame(1))
+		for _, bad := range []AudioFormat{
+			{SampleRate: 0, Channels: 1, BitsPerSample: 16},
+			{SampleRate: 1000, Channels: 0, BitsPerSample: 16},
+			{SampleRate: 1000, Channels: 1, BitsPerSample: 12},
+		} {
+			assert.Error(t, snapshot.WriteWAV(&bytes.Buffer{}, bad))
+		}
+
+		snapshot.Frames[0].Data = snapshot.Frames[0].Data[:3]
+		assert.Error(t, snapshot.WriteWAV(&bytes.Buffer{}, format), "partial sample")
+	})
+}